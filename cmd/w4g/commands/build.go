@@ -1,13 +1,19 @@
 package commands
 
 import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/christopher-kleine/w4g/pkg/runtime"
 	"github.com/urfave/cli/v2"
 )
 
 func Build() *cli.Command {
 	return &cli.Command{
-		Name:  "build",
-		Usage: "Starts the build process of the project",
+		Name:      "build",
+		Usage:     "Starts the build process of the project",
+		ArgsUsage: "[DIR]",
 		Subcommands: []*cli.Command{
 			{
 				Name:  "native",
@@ -19,5 +25,41 @@ func Build() *cli.Command {
 }
 
 func build(c *cli.Context) error {
+	dir := c.Args().First()
+	if dir == "" {
+		dir = "."
+	}
+
+	p, err := detectProject(dir)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Building %s project\n", p.Name)
+	err = p.build(dir)
+	var failed *buildError
+	if errors.As(err, &failed) {
+		return cli.Exit(fmt.Sprintf("build failed: %v", failed.err), 1)
+	}
+	if err != nil {
+		return err
+	}
+
+	cart := p.cart(dir)
+	code, err := os.ReadFile(cart)
+	if err != nil {
+		return fmt.Errorf("the build produced no cart: %w", err)
+	}
+
+	diags := runtime.Validate(code)
+	for _, diag := range diags {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", cart, diag)
+	}
+	if diags.Failed() {
+		return cli.Exit(fmt.Sprintf("%s is no valid cart", cart), 1)
+	}
+
+	fmt.Printf("Built %s (%d bytes)\n", cart, len(code))
+
 	return nil
 }
@@ -1,18 +1,234 @@
 package commands
 
 import (
+	"bytes"
 	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
 
 	"github.com/urfave/cli/v2"
 )
 
-//go:embed templates
+// The templates contain hidden files like .gitignore and .cargo.
+//
+//go:embed all:templates
 var templates embed.FS
 
+// templateSuffix marks files that can't live in the tree under their own
+// name. A go.mod would make the template a module of its own, which go:embed
+// skips, and without it the Go sources would be built as part of w4g.
+const templateSuffix = ".template"
+
+// templateData is what the files listed in the Templates of a manifest are
+// rendered with.
+type templateData struct {
+	// Name is the name of the project, made of lower case letters, digits,
+	// dashes and underscores.
+	Name string
+
+	// Ident is the Name with underscores instead of dashes, for languages
+	// that use it as an identifier.
+	Ident string
+}
+
+// invalidNameChars are the characters a project name can't have in any of
+// the build systems.
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9_-]+`)
+
+func languageFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "lang",
+			Aliases: []string{"l"},
+			Usage:   "Language of the project, see --list",
+		},
+		&cli.BoolFlag{
+			Name:  "list",
+			Usage: "Lists the available languages",
+		},
+	}
+}
+
 func Create() *cli.Command {
 	return &cli.Command{
 		Name:      "create",
-		ArgsUsage: "<TEMPLATE> <PROJECT>",
+		ArgsUsage: "<PROJECT>",
 		Usage:     "Creates a new WASM-4 project in a new directory",
+		Flags:     languageFlags(),
+		Action:    runCreate,
+	}
+}
+
+func runCreate(c *cli.Context) error {
+	if c.Bool("list") {
+		return listLanguages(c.App.Writer)
+	}
+
+	dir := c.Args().First()
+	if dir == "" {
+		return errors.New("a project directory is required")
+	}
+
+	err := createProject(c.String("lang"), dir)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\nStart developing with:\n    cd %s\n    w4g watch\n", dir)
+
+	return nil
+}
+
+// listLanguages writes the languages there are templates for to w.
+func listLanguages(w io.Writer) error {
+	all, err := manifests()
+	if err != nil {
+		return err
+	}
+
+	for _, m := range all {
+		name := m.Name
+		if len(m.Aliases) > 0 {
+			name += " (" + strings.Join(m.Aliases, ", ") + ")"
+		}
+		fmt.Fprintf(w, "%-16s %s\n", m.Lang, name)
+	}
+
+	return nil
+}
+
+// createProject copies the template of lang into dir. The project is named
+// after the directory. Nothing is written if any of the files exists.
+func createProject(lang, dir string) error {
+	if lang == "" {
+		return errors.New("a language is required, see --list")
+	}
+
+	m, err := findManifest(lang)
+	if err != nil {
+		return err
+	}
+
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+
+	name := projectName(filepath.Base(abs))
+	if name == "" {
+		return fmt.Errorf("can't name a project after %q, use a directory name with letters", filepath.Base(abs))
+	}
+	data := templateData{
+		Name:  name,
+		Ident: strings.ReplaceAll(name, "-", "_"),
+	}
+
+	type file struct {
+		src, dst string
+		render   bool
+	}
+
+	root := path.Join("templates", m.Lang)
+	var files []file
+	err = fs.WalkDir(templates, root, func(src string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+
+		rel := strings.TrimSuffix(strings.TrimPrefix(src, root+"/"), templateSuffix)
+		if rel == manifestFile {
+			return nil
+		}
+
+		f := file{src: src, render: m.isTemplate(rel)}
+		if rename, ok := m.Rename[rel]; ok {
+			renamed, err := render(rename, data)
+			if err != nil {
+				return fmt.Errorf("template %s: %w", m.Lang, err)
+			}
+			rel = string(renamed)
+		}
+
+		f.dst = filepath.Join(dir, filepath.FromSlash(rel))
+		if _, err := os.Lstat(f.dst); err == nil {
+			return fmt.Errorf("%s already exists, not overwriting it", f.dst)
+		}
+		files = append(files, f)
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		var content []byte
+		content, err = templates.ReadFile(f.src)
+		if err == nil && f.render {
+			content, err = render(string(content), data)
+		}
+		if err != nil {
+			return fmt.Errorf("template %s: %w", m.Lang, err)
+		}
+
+		err = writeFile(f.dst, content)
+		if err != nil {
+			return err
+		}
 	}
+
+	fmt.Printf("Created %s project %s in %s\n", m.Name, name, dir)
+
+	return nil
+}
+
+// isTemplate reports whether a file of the template is rendered.
+func (m *manifest) isTemplate(name string) bool {
+	for _, tmpl := range m.Templates {
+		if tmpl == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// writeFile writes a file of a new project, creating its directory.
+func writeFile(name string, content []byte) error {
+	err := os.MkdirAll(filepath.Dir(name), 0o755)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(name, content, 0o644)
+}
+
+// render executes a text/template with data.
+func render(text string, data templateData) ([]byte, error) {
+	tmpl, err := template.New("").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	err = tmpl.Execute(&b, data)
+
+	return b.Bytes(), err
+}
+
+// projectName turns a directory name into a name every build system
+// accepts: lower case letters, digits, dashes and underscores, starting with
+// a letter.
+func projectName(dir string) string {
+	name := invalidNameChars.ReplaceAllString(strings.ToLower(dir), "-")
+
+	return strings.TrimLeft(strings.TrimRight(name, "-_"), "-_0123456789")
 }
@@ -0,0 +1,312 @@
+package commands
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+// runApp runs w4g with args and returns what it wrote.
+func runApp(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+
+	var out bytes.Buffer
+	app := &cli.App{
+		Name:     "w4g",
+		Writer:   &out,
+		Commands: []*cli.Command{Create(), Init()},
+	}
+	err := app.Run(append([]string{"w4g"}, args...))
+
+	return out.String(), err
+}
+
+// projectFiles returns the files below dir, relative to it and with
+// slashes.
+func projectFiles(t *testing.T, dir string) []string {
+	t.Helper()
+
+	var files []string
+	err := filepath.WalkDir(dir, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, name)
+		files = append(files, filepath.ToSlash(rel))
+
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+
+	return files
+}
+
+func TestCreateProject(t *testing.T) {
+	all, err := manifests()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := templateData{Name: "my-game", Ident: "my_game"}
+
+	for _, m := range all {
+		t.Run(m.Lang, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "My Game")
+			err := createProject(m.Lang, dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Every file of the template but the manifest, without the
+			// suffix and renamed
+			root := path.Join("templates", m.Lang)
+			var want []string
+			err = fs.WalkDir(templates, root, func(src string, entry fs.DirEntry, err error) error {
+				if err != nil || entry.IsDir() {
+					return err
+				}
+
+				rel := strings.TrimPrefix(src, root+"/")
+				if rel == manifestFile {
+					return nil
+				}
+				rel = strings.TrimSuffix(rel, templateSuffix)
+				if rename, ok := m.Rename[rel]; ok {
+					renamed, err := render(rename, data)
+					if err != nil {
+						return err
+					}
+					rel = string(renamed)
+				}
+				want = append(want, rel)
+
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(want)
+
+			got := projectFiles(t, dir)
+			if strings.Join(got, "\n") != strings.Join(want, "\n") {
+				t.Fatalf("created\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+			}
+
+			for _, name := range got {
+				if strings.HasSuffix(name, templateSuffix) {
+					t.Errorf("%s keeps the suffix", name)
+				}
+			}
+
+			for _, name := range m.Templates {
+				content, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if bytes.Contains(content, []byte("{{")) {
+					t.Errorf("%s isn't rendered", name)
+				}
+				if !bytes.Contains(content, []byte(data.Name)) {
+					t.Errorf("%s doesn't name the project %s", name, data.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateProjectSubstitutes(t *testing.T) {
+	tests := []struct {
+		lang    string
+		file    string
+		content string
+		missing string
+	}{
+		{"go", "go.mod", "module my-game\n", "go.mod.template"},
+		{"go", "main.go", `import "my-game/w4"`, "main.go.template"},
+		{"go", "w4/wasm4.go", "package w4", "w4/wasm4.go.template"},
+		{"rust", "Cargo.toml", `name = "my-game"`, ""},
+		{"nim", "my_game.nimble", "", "cart.nimble"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.lang+"/"+test.file, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "My Game")
+			err := createProject(test.lang, dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			content, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(test.file)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(content), test.content) {
+				t.Errorf("%s doesn't contain %q", test.file, test.content)
+			}
+
+			if test.missing != "" {
+				if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(test.missing))); err == nil {
+					t.Errorf("%s was created", test.missing)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateProjectDoesntOverwrite(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "game")
+	err := os.Mkdir(dir, 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(dir, "Makefile"), []byte("mine"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = createProject("c", dir)
+	if err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("got %v, want the Makefile to exist", err)
+	}
+
+	// Nothing is written, not even the files that don't exist yet
+	files := projectFiles(t, dir)
+	if len(files) != 1 {
+		t.Errorf("created %v", files)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "Makefile"))
+	if err != nil || string(content) != "mine" {
+		t.Errorf("Makefile is %q, %v", content, err)
+	}
+}
+
+func TestCreateProjectErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		lang string
+		dir  string
+		want string
+	}{
+		{"no language", "", "game", "a language is required"},
+		{"unknown language", "cobol", "game", `unknown language "cobol"`},
+		{"no letters", "c", "2048", `can't name a project after "2048"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := createProject(test.lang, filepath.Join(t.TempDir(), test.dir))
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got %v, want %s", err, test.want)
+			}
+		})
+	}
+}
+
+func TestProjectName(t *testing.T) {
+	tests := []struct {
+		dir  string
+		want string
+	}{
+		{"game", "game"},
+		{"My Game", "my-game"},
+		{"my_game", "my_game"},
+		{"Space Invaders 2!", "space-invaders-2"},
+		{"2048-clone", "clone"},
+		{"_-game-_", "game"},
+		{"über", "ber"},
+		{"2048", ""},
+	}
+
+	for _, test := range tests {
+		if got := projectName(test.dir); got != test.want {
+			t.Errorf("projectName(%q) is %q, want %q", test.dir, got, test.want)
+		}
+	}
+}
+
+func TestCreateCommand(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "game")
+
+	_, err := runApp(t, "create", "--lang", "ts", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "asconfig.json")); err != nil {
+		t.Error(err)
+	}
+
+	_, err = runApp(t, "create", "--lang", "c")
+	if err == nil {
+		t.Error("created a project without a directory")
+	}
+}
+
+func TestInitCommand(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "game")
+	err := os.Mkdir(dir, 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chdir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	_, err = runApp(t, "init", "--lang", "rust")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile("Cargo.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), `name = "game"`) {
+		t.Errorf("Cargo.toml doesn't name the project after the directory:\n%s", content)
+	}
+}
+
+func TestListLanguages(t *testing.T) {
+	all, err := manifests()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, command := range []string{"create", "init"} {
+		out, err := runApp(t, command, "--list")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+		if len(lines) != len(all) {
+			t.Fatalf("%s --list printed %d languages, want %d:\n%s", command, len(lines), len(all), out)
+		}
+		for i, m := range all {
+			if fields := strings.Fields(lines[i]); fields[0] != m.Lang {
+				t.Errorf("%s --list: line %d is %q, want %s", command, i+1, lines[i], m.Lang)
+			}
+		}
+
+		if !strings.Contains(out, "AssemblyScript (as, ts)") {
+			t.Errorf("%s --list doesn't show the aliases:\n%s", command, out)
+		}
+	}
+}
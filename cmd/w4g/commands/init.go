@@ -1,8 +1,6 @@
 package commands
 
 import (
-	"fmt"
-
 	"github.com/urfave/cli/v2"
 )
 
@@ -10,14 +8,15 @@ func Init() *cli.Command {
 	return &cli.Command{
 		Name:   "init",
 		Usage:  "Creates a new WASM-4 project inside the current directory",
+		Flags:  languageFlags(),
 		Action: initCmd,
 	}
 }
 
 func initCmd(c *cli.Context) error {
-	if len(c.FlagNames()) == 0 {
-		return fmt.Errorf("a language is required")
+	if c.Bool("list") {
+		return listLanguages(c.App.Writer)
 	}
 
-	return nil
+	return createProject(c.String("lang"), ".")
 }
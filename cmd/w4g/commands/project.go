@@ -0,0 +1,231 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// manifestFile describes a template. It lives next to the files of the
+// template, but isn't copied into projects.
+const manifestFile = "template.json"
+
+// manifest describes a template: the language, how projects made from it
+// are recognized and how they are built.
+type manifest struct {
+	// Lang is the directory of the template, the name --lang takes.
+	Lang string `json:"-"`
+
+	Name    string   `json:"name"`
+	Aliases []string `json:"aliases"`
+
+	// Requires are the programs the build needs.
+	Requires []string `json:"requires"`
+
+	// Detect are globs that all match files of a project made from the
+	// template.
+	Detect []string `json:"detect"`
+
+	Build []string `json:"build"`
+
+	// Cart is where the build puts the cart.
+	Cart string `json:"cart"`
+
+	// Output are the directories the build writes to. They aren't watched.
+	Output []string `json:"output"`
+
+	// Templates are the files that are rendered with text/template, with
+	// templateData.
+	Templates []string `json:"templates"`
+
+	// Rename maps files to the names they get in a project. The names are
+	// templates as well.
+	Rename map[string]string `json:"rename"`
+}
+
+// manifests reads the manifests of all templates, ordered by language.
+func manifests() ([]*manifest, error) {
+	entries, err := templates.ReadDir("templates")
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*manifest
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		data, err := templates.ReadFile(path.Join("templates", entry.Name(), manifestFile))
+		if err != nil {
+			return nil, err
+		}
+
+		m := &manifest{Lang: entry.Name()}
+		err = json.Unmarshal(data, m)
+		if err != nil {
+			return nil, fmt.Errorf("template %s: %w", entry.Name(), err)
+		}
+
+		result = append(result, m)
+	}
+
+	return result, nil
+}
+
+// findManifest returns the manifest of a language, given by its name or one
+// of its aliases.
+func findManifest(lang string) (*manifest, error) {
+	all, err := manifests()
+	if err != nil {
+		return nil, err
+	}
+
+	lang = strings.ToLower(lang)
+	for _, m := range all {
+		if m.Lang == lang {
+			return m, nil
+		}
+
+		for _, alias := range m.Aliases {
+			if alias == lang {
+				return m, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("unknown language %q, see --list", lang)
+}
+
+// detectProject finds the template the project in dir was made from.
+func detectProject(dir string) (*manifest, error) {
+	all, err := manifests()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range all {
+		if m.detect(dir) {
+			return m, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%s is no WASM-4 project of any of the templates", dir)
+}
+
+func (m *manifest) detect(dir string) bool {
+	for _, pattern := range m.Detect {
+		matches, _ := filepath.Glob(filepath.Join(dir, filepath.FromSlash(pattern)))
+		if len(matches) == 0 {
+			return false
+		}
+	}
+
+	return len(m.Detect) > 0
+}
+
+// cart returns where the build puts the cart of the project in dir.
+func (m *manifest) cart(dir string) string {
+	return filepath.Join(dir, filepath.FromSlash(m.Cart))
+}
+
+// ignore tells the files in dir that don't belong to the sources: hidden
+// files, carts and the output of the build.
+func (m *manifest) ignore(dir string) func(string, fs.FileInfo) bool {
+	return func(path string, info fs.FileInfo) bool {
+		name := info.Name()
+		if strings.HasPrefix(name, ".") || strings.HasSuffix(name, ".wasm") {
+			return true
+		}
+
+		for _, output := range m.Output {
+			if path == filepath.Join(dir, filepath.FromSlash(output)) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+// build runs the build of the project in dir. Its output goes to the
+// terminal.
+func (m *manifest) build(dir string) error {
+	if len(m.Build) == 0 {
+		return fmt.Errorf("%s projects have no build command", m.Name)
+	}
+
+	for _, program := range m.Requires {
+		if _, err := exec.LookPath(program); err != nil {
+			return fmt.Errorf("%s projects need %s, which isn't installed or not in PATH", m.Name, program)
+		}
+	}
+
+	var output bytes.Buffer
+
+	cmd := exec.Command(m.Build[0], m.Build[1:]...)
+	cmd.Dir = dir
+	cmd.Stdout = io.MultiWriter(os.Stdout, &output)
+	cmd.Stderr = io.MultiWriter(os.Stderr, &output)
+
+	err := cmd.Run()
+	if err != nil {
+		return &buildError{err: err, output: output.String()}
+	}
+
+	return nil
+}
+
+// buildError is a failed build.
+type buildError struct {
+	err    error
+	output string
+}
+
+// Error returns the compiler messages starting with the first error, or the
+// end of the output if no line mentions one. The lines of make itself only
+// say that the compiler failed.
+func (e *buildError) Error() string {
+	const maxLines = 10
+
+	var lines []string
+	for _, line := range strings.Split(e.output, "\n") {
+		if strings.TrimSpace(line) != "" && !strings.HasPrefix(line, "make: ") && !strings.HasPrefix(line, "make[") {
+			lines = append(lines, line)
+		}
+	}
+
+	first := -1
+	for i, line := range lines {
+		if strings.Contains(strings.ToLower(line), "error") {
+			first = i
+			break
+		}
+	}
+
+	switch {
+	case len(lines) == 0:
+		return e.err.Error()
+	case first >= 0:
+		lines = lines[first:]
+	case len(lines) > maxLines:
+		lines = lines[len(lines)-maxLines:]
+	}
+
+	if len(lines) > maxLines {
+		lines = lines[:maxLines]
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func (e *buildError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,312 @@
+package commands
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeInfo is the fs.FileInfo of a file named name.
+type fakeInfo struct {
+	name string
+	dir  bool
+}
+
+func (i fakeInfo) Name() string       { return i.name }
+func (i fakeInfo) Size() int64        { return 0 }
+func (i fakeInfo) Mode() fs.FileMode  { return 0o644 }
+func (i fakeInfo) ModTime() time.Time { return time.Time{} }
+func (i fakeInfo) IsDir() bool        { return i.dir }
+func (i fakeInfo) Sys() any           { return nil }
+
+func TestManifests(t *testing.T) {
+	all, err := manifests()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) == 0 {
+		t.Fatal("no templates")
+	}
+
+	for i, m := range all {
+		if i > 0 && all[i-1].Lang >= m.Lang {
+			t.Errorf("%s comes after %s", m.Lang, all[i-1].Lang)
+		}
+
+		if m.Name == "" || len(m.Detect) == 0 || len(m.Build) == 0 || m.Cart == "" {
+			t.Errorf("%s: manifest misses a name, detect, build or cart: %+v", m.Lang, m)
+		}
+
+		// The build program itself is required
+		found := false
+		for _, program := range m.Requires {
+			found = found || program == m.Build[0]
+		}
+		if !found {
+			t.Errorf("%s: %s isn't in requires %v", m.Lang, m.Build[0], m.Requires)
+		}
+
+		// Rendered and renamed files are files of the template
+		var names []string
+		names = append(names, m.Templates...)
+		for name := range m.Rename {
+			names = append(names, name)
+		}
+		for _, name := range names {
+			src := path.Join("templates", m.Lang, name)
+			if _, err := fs.Stat(templates, src); err != nil {
+				if _, err := fs.Stat(templates, src+templateSuffix); err != nil {
+					t.Errorf("%s: template has no file %s", m.Lang, name)
+				}
+			}
+		}
+	}
+}
+
+func TestManifest(t *testing.T) {
+	m, err := findManifest("rust")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Lang != "rust" || m.Name != "Rust" {
+		t.Errorf("got %s, %s", m.Lang, m.Name)
+	}
+	if strings.Join(m.Aliases, " ") != "rs" {
+		t.Errorf("aliases %v", m.Aliases)
+	}
+	if strings.Join(m.Requires, " ") != "cargo" {
+		t.Errorf("requires %v", m.Requires)
+	}
+	if strings.Join(m.Build, " ") != "cargo build --release" {
+		t.Errorf("build %v", m.Build)
+	}
+	if strings.Join(m.Output, " ") != "target" {
+		t.Errorf("output %v", m.Output)
+	}
+	if strings.Join(m.Templates, " ") != "Cargo.toml" {
+		t.Errorf("templates %v", m.Templates)
+	}
+}
+
+func TestFindManifest(t *testing.T) {
+	tests := []struct {
+		lang string
+		want string
+	}{
+		{"c", "c"},
+		{"cpp", "c"},
+		{"C++", "c"},
+		{"ts", "assemblyscript"},
+		{"AssemblyScript", "assemblyscript"},
+		{"tinygo", "go"},
+		{"rs", "rust"},
+		{"wasm", "wat"},
+	}
+
+	for _, test := range tests {
+		m, err := findManifest(test.lang)
+		if err != nil {
+			t.Errorf("%s: %v", test.lang, err)
+			continue
+		}
+		if m.Lang != test.want {
+			t.Errorf("%s is %s, want %s", test.lang, m.Lang, test.want)
+		}
+	}
+
+	_, err := findManifest("cobol")
+	if err == nil || !strings.Contains(err.Error(), `unknown language "cobol"`) {
+		t.Errorf("got %v for an unknown language", err)
+	}
+}
+
+func TestDetectProject(t *testing.T) {
+	all, err := manifests()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// testdata/projects has a project of every template, named after it
+	for _, m := range all {
+		dir := filepath.Join("testdata", "projects", m.Lang)
+		got, err := detectProject(dir)
+		if err != nil {
+			t.Errorf("%s: %v", m.Lang, err)
+			continue
+		}
+		if got.Lang != m.Lang {
+			t.Errorf("%s is detected as %s", dir, got.Lang)
+		}
+	}
+
+	for _, dir := range []string{filepath.Join("testdata", "projects", "none"), t.TempDir()} {
+		m, err := detectProject(dir)
+		if err == nil {
+			t.Errorf("%s is detected as %s", dir, m.Lang)
+		}
+	}
+}
+
+func TestDetectNeedsAllPatterns(t *testing.T) {
+	m := &manifest{Detect: []string{"Makefile", "src/*.c*"}}
+
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "Makefile"), nil, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.detect(dir) {
+		t.Error("detected without sources")
+	}
+
+	err = os.Mkdir(filepath.Join(dir, "src"), 0o755)
+	if err == nil {
+		err = os.WriteFile(filepath.Join(dir, "src", "main.cpp"), nil, 0o644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.detect(dir) {
+		t.Error("not detected with sources")
+	}
+
+	// A manifest without patterns never matches
+	if (&manifest{}).detect(dir) {
+		t.Error("detected without patterns")
+	}
+}
+
+func TestManifestCart(t *testing.T) {
+	m := &manifest{Cart: "target/wasm32-unknown-unknown/release/cart.wasm"}
+
+	want := filepath.Join("game", "target", "wasm32-unknown-unknown", "release", "cart.wasm")
+	if got := m.cart("game"); got != want {
+		t.Errorf("cart is %s, want %s", got, want)
+	}
+}
+
+func TestManifestIgnore(t *testing.T) {
+	dir := filepath.Join("projects", "game")
+	ignore := (&manifest{Output: []string{"build", "zig-out/lib"}}).ignore(dir)
+
+	tests := []struct {
+		path string
+		dir  bool
+		want bool
+	}{
+		{"src", true, false},
+		{filepath.Join("src", "main.c"), false, false},
+		{"Makefile", false, false},
+		{".git", true, true},
+		{filepath.Join("src", ".main.c.swp"), false, true},
+		{"cart.wasm", false, true},
+		{"build", true, true},
+		{filepath.Join("zig-out", "lib"), true, true},
+		{"zig-out", true, false},
+		{filepath.Join("src", "build"), true, false},
+	}
+
+	for _, test := range tests {
+		path := filepath.Join(dir, test.path)
+		if got := ignore(path, fakeInfo{filepath.Base(path), test.dir}); got != test.want {
+			t.Errorf("ignore(%s) is %t, want %t", path, got, test.want)
+		}
+	}
+}
+
+func TestBuildRequires(t *testing.T) {
+	m := &manifest{Name: "Test", Requires: []string{"w4g-no-such-program"}, Build: []string{"w4g-no-such-program"}}
+
+	err := m.build(t.TempDir())
+	if err == nil || !strings.Contains(err.Error(), "Test projects need w4g-no-such-program") {
+		t.Errorf("got %v, want the missing program", err)
+	}
+
+	err = (&manifest{Name: "Test"}).build(t.TempDir())
+	if err == nil || !strings.Contains(err.Error(), "no build command") {
+		t.Errorf("got %v, want no build command", err)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh to build with")
+	}
+
+	dir := t.TempDir()
+	m := &manifest{Name: "Test", Requires: []string{"sh"}, Build: []string{"sh", "-c", "echo cart > cart.wasm"}}
+	err := m.build(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "cart.wasm")); err != nil {
+		t.Errorf("the build didn't run in the project: %v", err)
+	}
+
+	m.Build = []string{"sh", "-c", "echo compiling >&2; echo 'main.c:1: error: oops' >&2; exit 2"}
+	err = m.build(dir)
+
+	var failed *buildError
+	if !errors.As(err, &failed) {
+		t.Fatalf("got %v, want a buildError", err)
+	}
+	var exit *exec.ExitError
+	if !errors.As(err, &exit) || exit.ExitCode() != 2 {
+		t.Errorf("got %v, want exit status 2", failed.err)
+	}
+	if err.Error() != "main.c:1: error: oops" {
+		t.Errorf("got %q", err.Error())
+	}
+}
+
+func TestBuildError(t *testing.T) {
+	// lines returns the lines from to to of a build log
+	lines := func(from, to int) string {
+		var b strings.Builder
+		for i := from; i <= to; i++ {
+			b.WriteString("line ")
+			b.WriteString(string(rune('a' + i)))
+			b.WriteByte('\n')
+		}
+		return b.String()
+	}
+
+	tests := []struct {
+		name   string
+		output string
+		want   string
+	}{
+		{"no output", "", "exit status 2"},
+		{"only make", "make: *** [Makefile:3: all] Error 2\n", "exit status 2"},
+		{"blank lines", "\n  \n\t\n", "exit status 2"},
+		{
+			"from the first error",
+			"cc -c main.c\nmain.c:3: warning: unused\nmain.c:5: error: no x\nmain.c:6: Error: no y\n",
+			"main.c:5: error: no x\nmain.c:6: Error: no y",
+		},
+		{
+			"without make",
+			"make[1]: Entering directory '/game'\nmain.c:5: error: no x\nmake[1]: *** [all] Error 1\nmake: *** [all] Error 2\n",
+			"main.c:5: error: no x",
+		},
+		{"last lines without an error", lines(0, 14), strings.TrimSuffix(lines(5, 14), "\n")},
+		{"few lines without an error", lines(0, 2), strings.TrimSuffix(lines(0, 2), "\n")},
+		{"ten lines from the error", "ERROR here\n" + lines(0, 14), "ERROR here\n" + strings.TrimSuffix(lines(0, 8), "\n")},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := &buildError{err: errors.New("exit status 2"), output: test.output}
+			if got := err.Error(); got != test.want {
+				t.Errorf("got\n%s\nwant\n%s", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package commands
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/christopher-kleine/w4g/pkg/encoders"
+	"github.com/christopher-kleine/w4g/pkg/runtime"
+	"github.com/urfave/cli/v2"
+)
+
+func RenderAudio() *cli.Command {
+	return &cli.Command{
+		Name:      "render-audio",
+		Usage:     "Runs a WASM-4 cart without a window and writes its audio to a WAV file",
+		ArgsUsage: "<CART>",
+		Flags: []cli.Flag{
+			&cli.IntFlag{
+				Name:  "frames",
+				Usage: "Number of frames to run the cart for",
+				Value: 3600,
+			},
+			&cli.StringFlag{
+				Name:    "output",
+				Aliases: []string{"o"},
+				Usage:   "WAV file to write (Default: <CART>.wav)",
+			},
+		},
+		Action: renderAudio,
+	}
+}
+
+func renderAudio(c *cli.Context) error {
+	cart := c.Args().First()
+	if cart == "" {
+		return errors.New("no file provided")
+	}
+
+	output := c.String("output")
+	if output == "" {
+		output = strings.TrimSuffix(cart, filepath.Ext(cart)) + ".wav"
+	}
+
+	rt, err := runtime.NewRuntime()
+	if err != nil {
+		return err
+	}
+	defer rt.Close()
+
+	code, err := os.ReadFile(cart)
+	if err != nil {
+		return err
+	}
+
+	// Saves of the cart stay in memory and don't touch its disk file
+	rt.Storage = runtime.NewMemoryStorage(nil)
+	err = rt.LoadCart(code, cart)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+
+	err = writeAudio(f, rt, c.Int("frames"))
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// writeAudio runs frames frames of rt and writes their sound to f.
+func writeAudio(f *os.File, rt *runtime.Runtime, frames int) error {
+	wav, err := encoders.NewWAV(f, runtime.SampleRate, 2)
+	if err != nil {
+		return err
+	}
+
+	for frame := 0; frame < frames; frame++ {
+		err = rt.Step(runtime.InputState{})
+		if err != nil {
+			return err
+		}
+
+		err = wav.Write(rt.AudioSamples())
+		if err != nil {
+			return err
+		}
+	}
+
+	return wav.Close()
+}
@@ -1,22 +1,34 @@
 package commands
 
 import (
+	"crypto/sha256"
 	"errors"
 	"fmt"
+	"log"
 	"os"
 
 	"github.com/christopher-kleine/lorca"
 	"github.com/christopher-kleine/w4g/pkg/encoders"
+	"github.com/christopher-kleine/w4g/pkg/frontend"
+	"github.com/christopher-kleine/w4g/pkg/netplay"
 	"github.com/christopher-kleine/w4g/pkg/runtime"
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/urfave/cli/v2"
 )
 
+const (
+	traceFileSize    = 10 << 20
+	traceFileBackups = 3
+	consoleLines     = 64
+)
+
 func Run() *cli.Command {
 	return &cli.Command{
 		Name:      "run",
 		Usage:     "Starts a WASM-4 cart in the native client",
 		ArgsUsage: "<CART>",
+		Action:    runNative,
+		Flags:     nativeFlags(),
 		Subcommands: []*cli.Command{
 			{
 				Name:      "web",
@@ -30,11 +42,42 @@ func Run() *cli.Command {
 				Usage:     "Starts a WASM-4 cart in the native client",
 				Action:    runNative,
 				ArgsUsage: "<CART>",
+				Flags:     nativeFlags(),
 			},
 		},
 	}
 }
 
+func nativeFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  "record",
+			Usage: "Records the input into a movie file",
+		},
+		&cli.StringFlag{
+			Name:  "replay",
+			Usage: "Plays back the input of a movie file",
+		},
+		&cli.StringFlag{
+			Name:  "host",
+			Usage: "Waits for a second player to join on the given UDP address, e.g. :7777",
+		},
+		&cli.StringFlag{
+			Name:  "join",
+			Usage: "Joins the game hosted at the given UDP address as the second player",
+		},
+		&cli.StringFlag{
+			Name:  "reload",
+			Usage: "Reloads the cart when the file changes, carrying over nothing (restart), the memory (memory) or a save state (state)",
+		},
+		&cli.IntFlag{
+			Name:  "input-delay",
+			Usage: fmt.Sprintf("Frames of input delay during netplay, between 0 and %d. The delay of the host is used by both players", netplay.MaxRollback),
+			Value: netplay.DefaultDelay,
+		},
+	}
+}
+
 func runWeb(c *cli.Context) error {
 	ui, err := lorca.New("", "", 640, 640)
 	if err != nil {
@@ -52,44 +95,254 @@ func runNative(c *cli.Context) error {
 		return errors.New("no file provided")
 	}
 
-	showFPS := c.Bool("fps")
-	scale := c.Int("scale")
+	if delay := c.Int("input-delay"); delay < 0 || delay > netplay.MaxRollback {
+		return fmt.Errorf("--input-delay must be between 0 and %d", netplay.MaxRollback)
+	}
+
+	rt, err := runtime.NewRuntime()
+	if err != nil {
+		return err
+	}
+	defer rt.Close()
+
+	game, closeGame, err := newNativeGame(c, rt)
+	if err != nil {
+		return err
+	}
+	defer closeGame()
+
+	modes := 0
+	for _, name := range []string{"record", "replay", "host", "join"} {
+		if c.String(name) != "" {
+			modes++
+		}
+	}
+	if modes > 1 {
+		return errors.New("only one of --record, --replay, --host and --join can be used")
+	}
+
+	// Dropping frames would make movies and netplay go out of sync
+	if modes > 0 && rt.OnOverrun != runtime.OverrunAbort {
+		log.Printf("overrun policy %s changed to abort for movies and netplay", rt.OnOverrun)
+		rt.OnOverrun = runtime.OverrunAbort
+	}
+
+	if reload := c.String("reload"); reload != "" {
+		if modes > 0 {
+			return errors.New("--reload can't be used with movies or netplay")
+		}
+
+		mode, err := runtime.ParseReloadMode(reload)
+		if err != nil {
+			return err
+		}
+
+		game.EnableReload(cart, mode)
+	}
+
+	var movie *runtime.Movie
+	if replay := c.String("replay"); replay != "" {
+		movie, err = readMovie(replay)
+		if err != nil {
+			return err
+		}
+
+		// The movie only plays back correctly with the disk it was recorded with
+		rt.Storage = runtime.NewMemoryStorage(movie.Disk)
+	}
+
+	code, err := os.ReadFile(cart)
+	if err != nil {
+		return err
+	}
+
+	var peer *netplay.Peer
+	if join := c.String("join"); join != "" {
+		var disk []byte
+		peer, disk, err = netplay.Join(join, sha256.Sum256(code))
+		if err != nil {
+			return err
+		}
+		defer peer.Close()
+
+		if c.IsSet("input-delay") && c.Int("input-delay") != peer.Delay() {
+			log.Printf("using the input delay of the host, %d frames", peer.Delay())
+		}
+
+		// Both players have to start with the same disk
+		rt.Storage = runtime.NewMemoryStorage(disk)
+	}
+
+	// A crash in start is shown in the window like any other crash
+	err = rt.LoadCart(code, cart)
+	var crash *runtime.Crash
+	if err != nil && !errors.As(err, &crash) {
+		return err
+	}
+
+	if host := c.String("host"); host != "" {
+		log.Printf("waiting for a player to join on %s", host)
+		peer, err = netplay.Host(host, rt.CartHash(), rt.InitialDisk(), c.Int("input-delay"))
+		if err != nil {
+			return err
+		}
+		defer peer.Close()
+	}
+
+	if peer != nil {
+		game.Netplay, err = netplay.NewSession(rt, peer, c.String("host") != "")
+		if err != nil {
+			return err
+		}
+
+		// The other player keeps going while this window is in the background
+		ebiten.SetRunnableOnUnfocused(true)
+	}
+
+	if movie != nil {
+		err = movie.Check(rt)
+		if err != nil {
+			return err
+		}
+
+		game.ReplayMovie(movie)
+	}
 
-	rt, err := runtime.NewRuntime(showFPS)
+	record := c.String("record")
+	if record != "" {
+		movie = rt.NewMovie()
+		game.RecordMovie(movie)
+	}
+
+	err = runWindow(c, game)
 	if err != nil {
 		return err
 	}
 
+	if record != "" {
+		return writeMovie(record, movie)
+	}
+
+	return nil
+}
+
+// newNativeGame creates the native client for rt, set up by the global
+// flags. The returned function releases what the game opened.
+func newNativeGame(c *cli.Context, rt *runtime.Runtime) (*frontend.Game, func(), error) {
+	var err error
+
+	game := frontend.NewGame(rt, c.Bool("fps"))
+
+	var file *runtime.FileSink
+	closeGame := func() {
+		if file != nil {
+			file.Close()
+		}
+		game.Close()
+	}
+
 	enc := c.String("encoder")
 	switch enc {
 	case "y4m":
-		rt.Encoder = encoders.NewY4M()
+		game.Encoder = encoders.NewY4M()
 
 	case "mjpeg":
-		rt.Encoder = encoders.NewMJPEG(c.Int("quality"))
+		game.Encoder = encoders.NewMJPEG(c.Int("quality"))
 
 	default:
-		return fmt.Errorf("unknown encoder %q selected", enc)
+		closeGame()
+		return nil, nil, fmt.Errorf("unknown encoder %q selected", enc)
 	}
 
-	code, err := os.ReadFile(cart)
+	rt.Budget = c.Duration("budget")
+	rt.OnOverrun, err = runtime.ParseOverrunPolicy(c.String("overrun"))
 	if err != nil {
-		return err
+		closeGame()
+		return nil, nil, err
 	}
 
-	err = rt.LoadCart(code, cart)
+	var sink runtime.TraceSink = runtime.NewStderrSink()
+	if name := c.String("trace-file"); name != "" {
+		file, err = runtime.NewFileSink(name, traceFileSize, traceFileBackups)
+		if err != nil {
+			closeGame()
+			return nil, nil, err
+		}
+
+		sink = file
+	}
+
+	game.Console = runtime.NewMemorySink(consoleLines)
+	rt.TraceSink = runtime.MultiSink{sink, game.Console}
+
+	err = game.EnableAudio(c.Duration("audio-buffer"), c.Duration("audio-latency"))
 	if err != nil {
-		return err
+		log.Printf("audio disabled: %v", err)
+	}
+
+	game.EnableRewind(c.Duration("rewind"))
+
+	mapping, err := loadMapping(c.String("input-config"))
+	if err != nil {
+		log.Printf("default input mapping used: %v", err)
+	} else {
+		game.Mapping = mapping
 	}
 
+	return game, closeGame, nil
+}
+
+// runWindow opens the window of the native client and runs the game until
+// it is closed.
+func runWindow(c *cli.Context, game *frontend.Game) error {
+	scale := c.Int("scale")
+
 	ebiten.SetWindowSize(160*scale, 160*scale)
 	ebiten.SetWindowTitle("WASM-4 (Go)")
 	ebiten.SetMaxTPS(60)
 	ebiten.SetFPSMode(ebiten.FPSModeVsyncOn)
-	err = ebiten.RunGame(rt)
+
+	return ebiten.RunGame(game)
+}
+
+func loadMapping(name string) (*frontend.Mapping, error) {
+	var err error
+	if name == "" {
+		name, err = frontend.DefaultInputConfigPath()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	config, err := frontend.LoadInputConfig(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return config.Mapping()
+}
+
+func readMovie(name string) (*runtime.Movie, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return runtime.ReadMovie(f)
+}
+
+func writeMovie(name string, movie *runtime.Movie) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+
+	err = movie.Save(f)
 	if err != nil {
+		f.Close()
 		return err
 	}
 
-	return rt.Close()
+	return f.Close()
 }
@@ -1,3 +0,0 @@
-module cart
-
-go 1.16
@@ -0,0 +1,75 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/christopher-kleine/w4g/pkg/script"
+	"github.com/urfave/cli/v2"
+)
+
+func Test() *cli.Command {
+	return &cli.Command{
+		Name:      "test",
+		Usage:     "Runs a WASM-4 cart headlessly following test scripts",
+		ArgsUsage: "<CART> <SCRIPT>...",
+		Action:    runTest,
+	}
+}
+
+func runTest(c *cli.Context) error {
+	if c.NArg() < 2 {
+		return errors.New("a cart and at least one script are required")
+	}
+
+	cart := c.Args().First()
+	code, err := os.ReadFile(cart)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, name := range c.Args().Tail() {
+		err = runScript(code, cart, name)
+
+		var failures script.Failures
+		switch {
+		case errors.As(err, &failures):
+			for _, failure := range failures {
+				fmt.Fprintln(os.Stderr, failure)
+			}
+			fmt.Printf("FAIL %s\n", name)
+			failed++
+
+		case err != nil:
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Printf("FAIL %s\n", name)
+			failed++
+
+		default:
+			fmt.Printf("ok   %s\n", name)
+		}
+	}
+
+	if failed > 0 {
+		return cli.Exit(fmt.Sprintf("%d of %d scripts failed", failed, c.NArg()-1), 1)
+	}
+
+	return nil
+}
+
+func runScript(code []byte, cart, name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	s, err := script.Parse(f, name)
+	if err != nil {
+		return err
+	}
+
+	return s.Run(code, cart)
+}
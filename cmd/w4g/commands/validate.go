@@ -0,0 +1,54 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/christopher-kleine/w4g/pkg/runtime"
+	"github.com/urfave/cli/v2"
+)
+
+func Validate() *cli.Command {
+	return &cli.Command{
+		Name:      "validate",
+		Usage:     "Checks WASM-4 carts against the limits of the platform",
+		ArgsUsage: "<CART>...",
+		Action:    runValidate,
+	}
+}
+
+func runValidate(c *cli.Context) error {
+	if c.NArg() < 1 {
+		return errors.New("at least one cart is required")
+	}
+
+	failed := 0
+	for _, cart := range c.Args().Slice() {
+		code, err := os.ReadFile(cart)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Printf("FAIL %s\n", cart)
+			failed++
+			continue
+		}
+
+		diags := runtime.Validate(code)
+		for _, diag := range diags {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", cart, diag)
+		}
+
+		if diags.Failed() {
+			fmt.Printf("FAIL %s\n", cart)
+			failed++
+		} else {
+			fmt.Printf("ok   %s\n", cart)
+		}
+	}
+
+	if failed > 0 {
+		return cli.Exit(fmt.Sprintf("%d of %d carts failed", failed, c.NArg()), 1)
+	}
+
+	return nil
+}
@@ -1,17 +1,101 @@
 package commands
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/christopher-kleine/w4g/pkg/runtime"
+	"github.com/christopher-kleine/w4g/pkg/watch"
 	"github.com/urfave/cli/v2"
 )
 
 func Watch() *cli.Command {
 	return &cli.Command{
-		Name:   "watch",
-		Usage:  "Starts the build process and watches for changes",
-		Action: watch,
+		Name:      "watch",
+		Usage:     "Rebuilds the project when its sources change and reloads the cart in the native client",
+		ArgsUsage: "[DIR]",
+		Action:    runWatch,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "reload",
+				Usage: "What a new build carries over from the running one: nothing (restart), the memory (memory) or a save state (state)",
+				Value: "state",
+			},
+		},
 	}
 }
 
-func watch(c *cli.Context) error {
-	return nil
+func runWatch(c *cli.Context) error {
+	dir := c.Args().First()
+	if dir == "" {
+		dir = "."
+	}
+
+	p, err := detectProject(dir)
+	if err != nil {
+		return err
+	}
+
+	mode, err := runtime.ParseReloadMode(c.String("reload"))
+	if err != nil {
+		return err
+	}
+
+	log.Printf("building %s project", p.Name)
+	buildErr := p.build(dir)
+
+	// An older cart still lets us start
+	cart := p.cart(dir)
+	code, err := os.ReadFile(cart)
+	if err != nil {
+		if buildErr != nil {
+			return buildErr
+		}
+		return fmt.Errorf("the build produced no cart: %w", err)
+	}
+
+	rt, err := runtime.NewRuntime()
+	if err != nil {
+		return err
+	}
+	defer rt.Close()
+
+	game, closeGame, err := newNativeGame(c, rt)
+	if err != nil {
+		return err
+	}
+	defer closeGame()
+
+	err = rt.LoadCart(code, cart)
+	var crash *runtime.Crash
+	if err != nil && !errors.As(err, &crash) {
+		return err
+	}
+
+	game.ReportBuild(buildErr)
+	game.EnableReload(cart, mode)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w := watch.New(dir)
+	w.Ignore = p.ignore(dir)
+	changes := w.Watch(ctx)
+
+	// The new cart is picked up by the reload of the game
+	go func() {
+		for changed := range changes {
+			log.Printf("%s changed, rebuilding", changed[0])
+			err := p.build(dir)
+			if err != nil {
+				log.Printf("build failed: %v", err)
+			}
+			game.ReportBuild(err)
+		}
+	}()
+
+	return runWindow(c, game)
 }
@@ -3,6 +3,7 @@ package main
 import (
 	"log"
 	"os"
+	"time"
 
 	"github.com/christopher-kleine/w4g/cmd/w4g/commands"
 	"github.com/urfave/cli/v2"
@@ -41,6 +42,38 @@ func main() {
 				Usage:   "Quality setting for the MJPEG encoder",
 				Value:   80,
 			},
+			&cli.DurationFlag{
+				Name:  "audio-buffer",
+				Usage: "Maximum amount of audio queued ahead of the player",
+				Value: 100 * time.Millisecond,
+			},
+			&cli.DurationFlag{
+				Name:  "audio-latency",
+				Usage: "Buffer size of the audio player",
+				Value: 50 * time.Millisecond,
+			},
+			&cli.StringFlag{
+				Name:  "input-config",
+				Usage: "JSON file mapping keys and gamepads to the WASM-4 gamepads (Default: input.json in the user config directory)",
+			},
+			&cli.StringFlag{
+				Name:  "trace-file",
+				Usage: "Writes the trace output of the cart to a rotating log file instead of stderr",
+			},
+			&cli.DurationFlag{
+				Name:  "rewind",
+				Usage: "How far back the native client can rewind with backspace, 0 to disable",
+				Value: 10 * time.Second,
+			},
+			&cli.DurationFlag{
+				Name:  "budget",
+				Usage: "Time a single frame of the cart may take before the watchdog steps in, e.g. 500ms. Off by default, as skip and pause save the state of every frame",
+			},
+			&cli.StringFlag{
+				Name:  "overrun",
+				Usage: "What the watchdog does with a frame over budget (skip, pause, abort)",
+				Value: "pause",
+			},
 		},
 		EnableBashCompletion: true,
 		Authors: []*cli.Author{
@@ -57,12 +90,15 @@ func main() {
 		Commands: []*cli.Command{
 			commands.Create(),
 			commands.Init(),
-			//commands.Watch(),
+			commands.Watch(),
 			//commands.Web(),
 			commands.Run(),
+			commands.RenderAudio(),
+			commands.Test(),
+			commands.Validate(),
 			//commands.Img2Src(),
 			//commands.Install(),
-			//commands.Build(),
+			commands.Build(),
 			//commands.Bundle(),
 			commands.Surf(),
 		},
@@ -0,0 +1,80 @@
+package encoders
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// WAV writes 16-bit PCM samples into a RIFF/WAVE file. The chunk sizes in
+// the header are fixed up by Close, so the target needs to be seekable.
+type WAV struct {
+	w    io.WriteSeeker
+	size uint32
+}
+
+const wavHeaderSize = 44
+
+func NewWAV(w io.WriteSeeker, sampleRate, channels int) (*WAV, error) {
+	header := make([]byte, wavHeaderSize)
+	copy(header[0:], "RIFF")
+	copy(header[8:], "WAVE")
+	copy(header[12:], "fmt ")
+	binary.LittleEndian.PutUint32(header[16:], 16)
+	binary.LittleEndian.PutUint16(header[20:], 1) // PCM
+	binary.LittleEndian.PutUint16(header[22:], uint16(channels))
+	binary.LittleEndian.PutUint32(header[24:], uint32(sampleRate))
+	binary.LittleEndian.PutUint32(header[28:], uint32(sampleRate*channels*2))
+	binary.LittleEndian.PutUint16(header[32:], uint16(channels*2))
+	binary.LittleEndian.PutUint16(header[34:], 16)
+	copy(header[36:], "data")
+
+	_, err := w.Write(header)
+	if err != nil {
+		return nil, err
+	}
+
+	return &WAV{
+		w: w,
+	}, nil
+}
+
+// Write appends interleaved samples to the data chunk.
+func (wav *WAV) Write(samples []int16) error {
+	buf := make([]byte, len(samples)*2)
+	for i, sample := range samples {
+		binary.LittleEndian.PutUint16(buf[i*2:], uint16(sample))
+	}
+
+	n, err := wav.w.Write(buf)
+	wav.size += uint32(n)
+
+	return err
+}
+
+// Close writes the final chunk sizes into the header. It doesn't close the
+// underlying writer.
+func (wav *WAV) Close() error {
+	buf := make([]byte, 4)
+
+	binary.LittleEndian.PutUint32(buf, wavHeaderSize-8+wav.size)
+	_, err := wav.w.Seek(4, io.SeekStart)
+	if err == nil {
+		_, err = wav.w.Write(buf)
+	}
+	if err != nil {
+		return err
+	}
+
+	binary.LittleEndian.PutUint32(buf, wav.size)
+	_, err = wav.w.Seek(wavHeaderSize-4, io.SeekStart)
+	if err == nil {
+		_, err = wav.w.Write(buf)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = wav.w.Seek(0, io.SeekEnd)
+
+	return err
+}
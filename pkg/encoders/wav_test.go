@@ -0,0 +1,145 @@
+package encoders
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+)
+
+// seekBuffer is an in-memory io.WriteSeeker.
+type seekBuffer struct {
+	data []byte
+	pos  int
+}
+
+func (b *seekBuffer) Write(p []byte) (int, error) {
+	if end := b.pos + len(p); end > len(b.data) {
+		b.data = append(b.data, make([]byte, end-len(b.data))...)
+	}
+	n := copy(b.data[b.pos:], p)
+	b.pos += n
+
+	return n, nil
+}
+
+func (b *seekBuffer) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += int64(b.pos)
+	case io.SeekEnd:
+		offset += int64(len(b.data))
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	b.pos = int(offset)
+
+	return offset, nil
+}
+
+func TestWAV(t *testing.T) {
+	var b seekBuffer
+
+	wav, err := NewWAV(&b, 44100, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = wav.Write([]int16{0, 1, -1, 32767})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = wav.Write([]int16{-32768, 256})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = wav.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const dataSize = 6 * 2
+	if len(b.data) != 44+dataSize {
+		t.Fatalf("file has %d bytes, want %d", len(b.data), 44+dataSize)
+	}
+
+	h := b.data[:44]
+	ids := []struct {
+		offset int
+		want   string
+	}{
+		{0, "RIFF"},
+		{8, "WAVE"},
+		{12, "fmt "},
+		{36, "data"},
+	}
+	for _, s := range ids {
+		if got := string(h[s.offset : s.offset+4]); got != s.want {
+			t.Errorf("header at %d is %q, want %q", s.offset, got, s.want)
+		}
+	}
+
+	fields := []struct {
+		name   string
+		offset int
+		size   int
+		want   uint32
+	}{
+		{"RIFF size", 4, 4, 36 + dataSize},
+		{"fmt size", 16, 4, 16},
+		{"format", 20, 2, 1},
+		{"channels", 22, 2, 2},
+		{"sample rate", 24, 4, 44100},
+		{"byte rate", 28, 4, 44100 * 2 * 2},
+		{"block align", 32, 2, 4},
+		{"bits per sample", 34, 2, 16},
+		{"data size", 40, 4, dataSize},
+	}
+	for _, f := range fields {
+		var got uint32
+		if f.size == 2 {
+			got = uint32(binary.LittleEndian.Uint16(h[f.offset:]))
+		} else {
+			got = binary.LittleEndian.Uint32(h[f.offset:])
+		}
+		if got != f.want {
+			t.Errorf("%s is %d, want %d", f.name, got, f.want)
+		}
+	}
+
+	want := []int16{0, 1, -1, 32767, -32768, 256}
+	for i, sample := range want {
+		if got := int16(binary.LittleEndian.Uint16(b.data[44+i*2:])); got != sample {
+			t.Errorf("sample %d is %d, want %d", i, got, sample)
+		}
+	}
+
+	// Close leaves the writer at the end for anything that follows
+	if b.pos != len(b.data) {
+		t.Errorf("writer left at %d of %d", b.pos, len(b.data))
+	}
+}
+
+func TestWAVEmpty(t *testing.T) {
+	var b seekBuffer
+
+	wav, err := NewWAV(&b, 22050, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = wav.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(b.data) != 44 {
+		t.Fatalf("file has %d bytes, want 44", len(b.data))
+	}
+	if size := binary.LittleEndian.Uint32(b.data[4:]); size != 36 {
+		t.Errorf("RIFF size is %d, want 36", size)
+	}
+	if size := binary.LittleEndian.Uint32(b.data[40:]); size != 0 {
+		t.Errorf("data size is %d, want 0", size)
+	}
+}
@@ -0,0 +1,80 @@
+package frontend
+
+import (
+	"time"
+
+	"github.com/christopher-kleine/w4g/pkg/tools"
+)
+
+const (
+	// bytesPerFrame is the size of one 16-bit stereo sample frame.
+	bytesPerFrame = 4
+
+	volumeStep = 0.1
+)
+
+// player plays the 16-bit stereo samples it reads.
+type player interface {
+	Play()
+	SetVolume(volume float64)
+	Close() error
+}
+
+// Audio streams the samples of the APU to the speakers.
+type Audio struct {
+	player player
+	buffer *RingBuffer
+	volume float64
+	muted  bool
+}
+
+// NewAudio starts playing everything written into buffer. latency is the
+// size of the player's own buffer. It returns an error if there is no
+// usable audio device.
+func NewAudio(buffer *RingBuffer, latency time.Duration) (*Audio, error) {
+	player, err := newPlayer(buffer, latency)
+	if err != nil {
+		return nil, err
+	}
+	player.Play()
+
+	return &Audio{
+		player: player,
+		buffer: buffer,
+		volume: 1,
+	}, nil
+}
+
+// ToggleMute mutes or unmutes the output without stopping the stream.
+func (a *Audio) ToggleMute() {
+	a.muted = !a.muted
+	a.apply()
+}
+
+// ChangeVolume changes the volume by delta, clamped to 0..1.
+func (a *Audio) ChangeVolume(delta float64) {
+	a.volume += delta
+	if a.volume < 0 {
+		a.volume = 0
+	}
+	if a.volume > 1 {
+		a.volume = 1
+	}
+	a.apply()
+}
+
+func (a *Audio) Volume() float64 {
+	return a.volume
+}
+
+func (a *Audio) Muted() bool {
+	return a.muted
+}
+
+func (a *Audio) apply() {
+	a.player.SetVolume(tools.Ternary(a.muted, 0, a.volume))
+}
+
+func (a *Audio) Close() error {
+	return a.player.Close()
+}
@@ -0,0 +1,26 @@
+//go:build android || darwin || js || windows
+
+package frontend
+
+import (
+	"io"
+	"time"
+
+	"github.com/christopher-kleine/w4g/pkg/runtime"
+	"github.com/hajimehoshi/ebiten/v2/audio"
+)
+
+// newPlayer plays r through ebiten, which always finds an audio device on
+// these platforms.
+func newPlayer(r io.Reader, latency time.Duration) (player, error) {
+	p, err := audio.NewContext(runtime.SampleRate).NewPlayer(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if latency > 0 {
+		p.SetBufferSize(latency)
+	}
+
+	return p, nil
+}
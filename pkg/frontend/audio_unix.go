@@ -0,0 +1,34 @@
+//go:build !android && !darwin && !js && !windows
+
+package frontend
+
+import (
+	"io"
+	"time"
+
+	"github.com/christopher-kleine/w4g/pkg/runtime"
+	"github.com/hajimehoshi/oto/v2"
+)
+
+// newPlayer plays r on the default ALSA device. ebiten only reports a
+// missing device once the game is running, and then as a fatal error, so
+// oto is used directly to be able to run without sound instead.
+//
+// oto offers no way to close a context, so the one that finds the device
+// is the one that plays.
+func newPlayer(r io.Reader, latency time.Duration) (player, error) {
+	ctx, ready, err := oto.NewContext(runtime.SampleRate, 2, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	<-ready
+
+	p := ctx.NewPlayer(r)
+	if latency > 0 {
+		frames := int(latency.Seconds() * runtime.SampleRate)
+		p.(oto.BufferSizeSetter).SetBufferSize(frames * bytesPerFrame)
+	}
+
+	return p, nil
+}
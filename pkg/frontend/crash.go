@@ -0,0 +1,147 @@
+package frontend
+
+import (
+	"fmt"
+	"image/color"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/christopher-kleine/w4g/pkg/runtime"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+)
+
+const (
+	// crashColumns is the number of characters of the debug font that fit
+	// into a line.
+	crashColumns = runtime.WIDTH / 6
+
+	// crashLines is the number of lines that fit onto the screen.
+	crashLines = runtime.HEIGHT / 16
+)
+
+// reportCrash logs a crash and writes its report. It only does so once per
+// crash.
+func (g *Game) reportCrash(crash *runtime.Crash) {
+	if g.crash == crash {
+		return
+	}
+	g.crash = crash
+
+	log.Println(crash)
+	for _, frame := range crash.Stack {
+		log.Println("    " + frame)
+	}
+
+	name, err := writeCrashReport(crash)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	log.Println("crash report written to", name)
+}
+
+// writeCrashReport writes the report next to the screenshots.
+func writeCrashReport(crash *runtime.Crash) (string, error) {
+	udir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	name := fmt.Sprintf("%s_crash_%v.txt", crash.Cart, crash.Time.Format("2006-01-02_15-04-05"))
+	name = filepath.Join(udir, name)
+	f, err := os.Create(name)
+	if err != nil {
+		return "", err
+	}
+
+	err = crash.WriteReport(f)
+	if err != nil {
+		f.Close()
+		return "", err
+	}
+
+	return name, f.Close()
+}
+
+// drawCrash covers the last picture of a crashed cart with the reason and
+// the innermost functions of the stack trace.
+func (g *Game) drawCrash(screen *ebiten.Image, crash *runtime.Crash) {
+	lines := []string{"CART CRASHED", fmt.Sprintf("IN FRAME %d", crash.Frame)}
+	lines = append(lines, wrap(crash.Reason, crashColumns)...)
+	for _, frame := range crash.Stack {
+		// The parameter types don't fit
+		if i := strings.IndexByte(frame, '('); i >= 0 {
+			frame = frame[:i]
+		}
+		lines = append(lines, wrap("at "+frame, crashColumns)...)
+	}
+
+	if len(lines) > crashLines-1 {
+		lines = lines[:crashLines-1]
+	}
+
+	if g.Rewind != nil && g.movie == nil {
+		lines = append(lines, "HOLD BACKSPACE: REWIND")
+	} else {
+		lines = append(lines, "F1-F4: LOAD A STATE")
+	}
+
+	ebitenutil.DrawRect(screen, 0, 0, runtime.WIDTH, runtime.HEIGHT, color.RGBA{R: 0x40, A: 0xe0})
+	for i, line := range lines {
+		ebitenutil.DebugPrintAt(screen, line, 0, i*16)
+	}
+}
+
+// drawOverrun tells the player that the cart is paused because a frame
+// took too long.
+func (g *Game) drawOverrun(screen *ebiten.Image, overrun *runtime.Overrun) {
+	lines := []string{"CART NOT RESPONDING", ""}
+	lines = append(lines, wrap(overrun.Error(), crashColumns)...)
+	lines = append(lines, "", "ENTER: TRY AGAIN")
+	if g.Rewind != nil && g.movie == nil {
+		lines = append(lines, "HOLD BACKSPACE: REWIND")
+	}
+
+	ebitenutil.DrawRect(screen, 0, 0, runtime.WIDTH, runtime.HEIGHT, color.RGBA{A: 0xc0})
+	for i, line := range lines {
+		ebitenutil.DebugPrintAt(screen, line, 0, i*16)
+	}
+}
+
+// wrap breaks text into lines of at most width characters, between words if
+// possible.
+func wrap(text string, width int) []string {
+	var lines []string
+
+	line := ""
+	for _, word := range strings.Fields(text) {
+		for len(word) > width {
+			if line != "" {
+				lines = append(lines, line)
+				line = ""
+			}
+			lines = append(lines, word[:width])
+			word = word[width:]
+		}
+
+		switch {
+		case line == "":
+			line = word
+		case len(line)+1+len(word) <= width:
+			line += " " + word
+		default:
+			lines = append(lines, line)
+			line = word
+		}
+	}
+
+	if line != "" {
+		lines = append(lines, line)
+	}
+
+	return lines
+}
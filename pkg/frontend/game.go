@@ -0,0 +1,356 @@
+package frontend
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image/color"
+	"image/png"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/christopher-kleine/w4g/pkg/encoders"
+	"github.com/christopher-kleine/w4g/pkg/netplay"
+	"github.com/christopher-kleine/w4g/pkg/runtime"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+// Game runs a Runtime inside an ebiten window. It translates keyboard,
+// mouse and gamepads into the input of the cart and presents its picture and
+// sound.
+type Game struct {
+	rt      *runtime.Runtime
+	showFPS bool
+	Encoder encoders.Encoder
+	Audio   *Audio
+	Rewind  *runtime.Rewind
+	Mapping *Mapping
+	Netplay *netplay.Session
+	Console *runtime.MemorySink
+
+	sampleBytes []byte
+	audioBuffer *RingBuffer
+	renderer    Renderer
+
+	notice       string
+	noticeFrames int
+
+	movie      *runtime.Movie
+	replaying  bool
+	movieFrame int
+
+	gamepads    [4]gamepadSlot
+	waiting     bool
+	showConsole bool
+
+	// crash is the last crash that was reported.
+	crash *runtime.Crash
+
+	reloadName        string
+	reloadMode        runtime.ReloadMode
+	reloads           <-chan []string
+	stopReload        func()
+	reloadError       string
+	reloadErrorFrames int
+
+	buildMu    sync.Mutex
+	buildError string
+}
+
+func NewGame(rt *runtime.Runtime, showFPS bool) *Game {
+	mapping, _ := DefaultInputConfig().Mapping()
+
+	return &Game{
+		rt:      rt,
+		showFPS: showFPS,
+		Mapping: mapping,
+	}
+}
+
+// EnableAudio streams the APU output to the speakers. bufferSize limits how
+// much audio is queued ahead of the player, latency sets the size of the
+// player's own buffer.
+func (g *Game) EnableAudio(bufferSize, latency time.Duration) error {
+	frames := int(bufferSize * runtime.SampleRate / time.Second)
+	if frames < runtime.SamplesPerFrame {
+		frames = runtime.SamplesPerFrame
+	}
+
+	g.audioBuffer = NewRingBuffer(frames * bytesPerFrame)
+
+	var err error
+	g.Audio, err = NewAudio(g.audioBuffer, latency)
+	if err != nil {
+		g.audioBuffer = nil
+		return err
+	}
+
+	return nil
+}
+
+// EnableRewind keeps the given duration of frames for rewinding.
+func (g *Game) EnableRewind(duration time.Duration) {
+	frames := int(duration * 60 / time.Second)
+	if frames <= 0 {
+		g.Rewind = nil
+		return
+	}
+
+	g.Rewind = runtime.NewRewind(g.rt, frames)
+}
+
+// queueAudio queues the samples of the last frame for playback.
+func (g *Game) queueAudio() {
+	if g.audioBuffer == nil {
+		return
+	}
+
+	samples := g.rt.AudioSamples()
+	if len(g.sampleBytes) != len(samples)*2 {
+		g.sampleBytes = make([]byte, len(samples)*2)
+	}
+
+	for i, sample := range samples {
+		binary.LittleEndian.PutUint16(g.sampleBytes[i*2:], uint16(sample))
+	}
+
+	g.audioBuffer.Write(g.sampleBytes)
+}
+
+func (g *Game) Close() error {
+	if g.Audio != nil {
+		g.Audio.Close()
+	}
+
+	if g.stopReload != nil {
+		g.stopReload()
+	}
+
+	return nil
+}
+
+func (g *Game) Screenshot(screen *ebiten.Image) {
+	udir, err := os.UserHomeDir()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	fname := fmt.Sprintf("%s_%v.png", g.rt.CartName(), time.Now().Format("2006-01-02_15-04-05"))
+	fname = filepath.Join(udir, fname)
+	f, err := os.Create(fname)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	err = png.Encode(f, screen)
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+func (g *Game) Draw(screen *ebiten.Image) {
+	g.renderer.Render(screen, g.rt.Framebuffer(), g.rt.Palette())
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyF9) {
+		g.Screenshot(screen)
+	}
+
+	if g.Encoder.IsRunning() {
+		g.Encoder.Encode(screen)
+	}
+
+	crash, overrun := g.rt.Crash(), g.rt.Paused()
+	switch {
+	case g.drawBuildError(screen):
+	case crash != nil:
+		g.drawCrash(screen, crash)
+	case overrun != nil:
+		g.drawOverrun(screen, overrun)
+	case g.showConsole && g.Console != nil:
+		g.drawConsole(screen)
+	}
+
+	if g.showFPS {
+		ebitenutil.DebugPrintAt(screen, fmt.Sprintf("%.f", ebiten.CurrentFPS()), 0, 0)
+	}
+
+	if g.Encoder.IsRunning() {
+		ebitenutil.DebugPrintAt(screen, "REC", 160-24, 0)
+	}
+
+	if g.Rewind != nil && g.movie == nil && ebiten.IsKeyPressed(RewindKey) {
+		ebitenutil.DebugPrintAt(screen, "<<", 160-36, 0)
+	}
+
+	if g.waiting {
+		ebitenutil.DebugPrintAt(screen, "WAIT", 160-24, 16)
+	}
+
+	if g.movie != nil && g.replaying {
+		ebitenutil.DebugPrintAt(screen, "PLAY", 160-24, 16)
+	}
+
+	if g.Audio != nil && g.Audio.Muted() {
+		ebitenutil.DebugPrintAt(screen, "MUTE", 160-24, 160-16)
+	}
+
+	if g.noticeFrames > 0 {
+		g.noticeFrames--
+		ebitenutil.DebugPrintAt(screen, g.notice, 0, 160-16)
+	}
+}
+
+// drawConsole prints the latest messages of the cart over the picture.
+func (g *Game) drawConsole(screen *ebiten.Image) {
+	const lines = 8
+
+	entries := g.Console.Entries()
+	if len(entries) > lines {
+		entries = entries[len(entries)-lines:]
+	}
+
+	ebitenutil.DrawRect(screen, 0, 0, runtime.WIDTH, runtime.HEIGHT, color.RGBA{A: 0xc0})
+	for i, entry := range entries {
+		ebitenutil.DebugPrintAt(screen, entry.Message, 0, 16+i*16)
+	}
+}
+
+// notify shows a short message at the bottom of the window for a second.
+func (g *Game) notify(format string, args ...any) {
+	g.notice = fmt.Sprintf(format, args...)
+	g.noticeFrames = 60
+}
+
+func (g *Game) Update() error {
+	if inpututil.IsKeyJustPressed(ebiten.KeyF10) {
+		if g.Encoder.IsRunning() {
+			g.Encoder.Stop()
+		} else {
+			g.Encoder.Start(g.rt.CartName())
+		}
+	}
+
+	if g.Audio != nil {
+		if inpututil.IsKeyJustPressed(ebiten.KeyF6) {
+			g.Audio.ToggleMute()
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyF7) {
+			g.Audio.ChangeVolume(-volumeStep)
+			g.notify("VOL %.f%%", g.Audio.Volume()*100)
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyF8) {
+			g.Audio.ChangeVolume(volumeStep)
+			g.notify("VOL %.f%%", g.Audio.Volume()*100)
+		}
+	}
+
+	for idx, key := range StateKeys {
+		if !inpututil.IsKeyJustPressed(key) {
+			continue
+		}
+
+		if ebiten.IsKeyPressed(ebiten.KeyShift) {
+			g.SaveState(idx + 1)
+		} else if g.movie == nil && g.Netplay == nil {
+			g.LoadState(idx + 1)
+		}
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyF5) {
+		g.showConsole = !g.showConsole
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyF11) {
+		g.showFPS = !g.showFPS
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyF12) {
+		if ebiten.CursorMode() == ebiten.CursorModeVisible {
+			ebiten.SetCursorMode(ebiten.CursorModeHidden)
+		} else {
+			ebiten.SetCursorMode(ebiten.CursorModeVisible)
+		}
+	}
+
+	if g.reloads != nil {
+		g.reload()
+	}
+
+	if g.Netplay != nil {
+		stepped, err := g.Netplay.Advance(g.Input().Gamepads[0])
+		var crash *runtime.Crash
+		if errors.As(err, &crash) {
+			g.reportCrash(crash)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		g.waiting = !stepped
+		if stepped {
+			g.queueAudio()
+		}
+
+		return nil
+	}
+
+	// Jumping around in time would break the movie
+	if g.Rewind != nil && g.movie == nil && ebiten.IsKeyPressed(RewindKey) {
+		ok, err := g.Rewind.Step()
+		if !ok {
+			g.notify("NO MORE FRAMES")
+		}
+
+		return err
+	}
+
+	// A crashed cart waits for a state to be restored
+	if crash := g.rt.Crash(); crash != nil {
+		g.reportCrash(crash)
+		return nil
+	}
+
+	if g.rt.Paused() != nil {
+		if !inpututil.IsKeyJustPressed(ebiten.KeyEnter) {
+			return nil
+		}
+
+		g.rt.Resume()
+	}
+
+	err := g.rt.Step(g.movieInput())
+	var crash *runtime.Crash
+	if errors.As(err, &crash) {
+		g.reportCrash(crash)
+		return nil
+	}
+	var overrun *runtime.Overrun
+	if errors.As(err, &overrun) {
+		if g.rt.Paused() != nil {
+			log.Println(overrun)
+		} else {
+			g.notify("FRAME SKIPPED")
+		}
+
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if g.Rewind != nil {
+		g.Rewind.Push()
+	}
+
+	g.queueAudio()
+
+	return nil
+}
+
+func (g *Game) Layout(int, int) (int, int) { return runtime.WIDTH, runtime.HEIGHT }
@@ -0,0 +1,150 @@
+package frontend
+
+import (
+	"github.com/christopher-kleine/w4g/pkg/runtime"
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// gamepadSlot is a gamepad assigned to one of the four players.
+type gamepadSlot struct {
+	id        ebiten.GamepadID
+	connected bool
+}
+
+// Input polls keyboard, mouse and gamepads.
+func (g *Game) Input() runtime.InputState {
+	var input runtime.InputState
+
+	x, y := ebiten.CursorPosition()
+	input.MouseX = int16(x)
+	input.MouseY = int16(y)
+
+	if ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft) {
+		input.MouseButtons |= runtime.MouseLeft
+	}
+	if ebiten.IsMouseButtonPressed(ebiten.MouseButtonRight) {
+		input.MouseButtons |= runtime.MouseRight
+	}
+	if ebiten.IsMouseButtonPressed(ebiten.MouseButtonMiddle) {
+		input.MouseButtons |= runtime.MouseMiddle
+	}
+
+	g.assignGamepads()
+
+	for player := range input.Gamepads {
+		input.Gamepads[player] = g.KeyState(player)
+
+		slot := g.gamepads[player]
+		if slot.connected {
+			input.Gamepads[player] = g.GamepadState(input.Gamepads[player], slot.id)
+		}
+	}
+
+	return input
+}
+
+// assignGamepads keeps track of connected gamepads. A new gamepad takes the
+// first free player, a disconnected one frees its player again.
+func (g *Game) assignGamepads() {
+	ids := ebiten.AppendGamepadIDs(nil)
+
+	for player, slot := range g.gamepads {
+		if slot.connected && !containsGamepad(ids, slot.id) {
+			g.gamepads[player].connected = false
+			g.notify("P%d DISCONNECTED", player+1)
+		}
+	}
+
+	for _, id := range ids {
+		if g.gamepadPlayer(id) >= 0 {
+			continue
+		}
+
+		for player, slot := range g.gamepads {
+			if !slot.connected {
+				g.gamepads[player] = gamepadSlot{id: id, connected: true}
+				g.notify("P%d CONNECTED", player+1)
+				break
+			}
+		}
+	}
+}
+
+func containsGamepad(ids []ebiten.GamepadID, id ebiten.GamepadID) bool {
+	for _, other := range ids {
+		if other == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (g *Game) gamepadPlayer(id ebiten.GamepadID) int {
+	for player, slot := range g.gamepads {
+		if slot.connected && slot.id == id {
+			return player
+		}
+	}
+
+	return -1
+}
+
+func (g *Game) KeyState(player int) byte {
+	result := runtime.PadIdle
+
+	for key, value := range g.Mapping.Keys[player] {
+		if ebiten.IsKeyPressed(key) {
+			result = result | value
+		}
+	}
+
+	return result
+}
+
+func (g *Game) GamepadState(current byte, id ebiten.GamepadID) byte {
+	if !ebiten.IsStandardGamepadLayoutAvailable(id) {
+		// Without a known layout, only the first buttons and the first stick
+		// are a safe bet.
+		if ebiten.IsGamepadButtonPressed(id, ebiten.GamepadButton0) {
+			current = current | runtime.PadX
+		}
+		if ebiten.IsGamepadButtonPressed(id, ebiten.GamepadButton1) {
+			current = current | runtime.PadY
+		}
+
+		return current | g.stickState(ebiten.GamepadAxisValue(id, 0), ebiten.GamepadAxisValue(id, 1))
+	}
+
+	for button, value := range g.Mapping.Buttons {
+		if ebiten.IsStandardGamepadButtonPressed(id, button) {
+			current = current | value
+		}
+	}
+
+	return current | g.stickState(
+		ebiten.StandardGamepadAxisValue(id, ebiten.StandardGamepadAxisLeftStickHorizontal),
+		ebiten.StandardGamepadAxisValue(id, ebiten.StandardGamepadAxisLeftStickVertical),
+	)
+}
+
+// stickState converts the position of a stick into the D-pad.
+func (g *Game) stickState(x, y float64) byte {
+	result := runtime.PadIdle
+
+	deadzone := g.Mapping.Deadzone
+	if x < -deadzone {
+		result |= runtime.PadLeft
+	}
+	if x > deadzone {
+		result |= runtime.PadRight
+	}
+	if y < -deadzone {
+		result |= runtime.PadUp
+	}
+	if y > deadzone {
+		result |= runtime.PadDown
+	}
+
+	return result
+}
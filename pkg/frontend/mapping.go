@@ -0,0 +1,193 @@
+package frontend
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/christopher-kleine/w4g/pkg/runtime"
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// InputConfig is the user-editable mapping of keys and gamepad buttons to
+// the buttons of the WASM-4 gamepads. Buttons are called x, z, left, right,
+// up and down. Keys use the names of ebiten.Key.String, gamepad buttons the
+// names of the standard layout without the StandardGamepadButton prefix.
+type InputConfig struct {
+	// Deadzone of the sticks, between 0 and 1.
+	Deadzone float64 `json:"deadzone"`
+
+	// Keyboard holds the keys of up to four players.
+	Keyboard []map[string][]string `json:"keyboard"`
+
+	// Gamepad is used for every connected gamepad.
+	Gamepad map[string][]string `json:"gamepad"`
+}
+
+var padButtons = map[string]byte{
+	"x":     runtime.PadX,
+	"z":     runtime.PadY,
+	"left":  runtime.PadLeft,
+	"right": runtime.PadRight,
+	"up":    runtime.PadUp,
+	"down":  runtime.PadDown,
+}
+
+var standardButtons = map[string]ebiten.StandardGamepadButton{
+	"RightBottom":      ebiten.StandardGamepadButtonRightBottom,
+	"RightRight":       ebiten.StandardGamepadButtonRightRight,
+	"RightLeft":        ebiten.StandardGamepadButtonRightLeft,
+	"RightTop":         ebiten.StandardGamepadButtonRightTop,
+	"FrontTopLeft":     ebiten.StandardGamepadButtonFrontTopLeft,
+	"FrontTopRight":    ebiten.StandardGamepadButtonFrontTopRight,
+	"FrontBottomLeft":  ebiten.StandardGamepadButtonFrontBottomLeft,
+	"FrontBottomRight": ebiten.StandardGamepadButtonFrontBottomRight,
+	"CenterLeft":       ebiten.StandardGamepadButtonCenterLeft,
+	"CenterRight":      ebiten.StandardGamepadButtonCenterRight,
+	"LeftStick":        ebiten.StandardGamepadButtonLeftStick,
+	"RightStick":       ebiten.StandardGamepadButtonRightStick,
+	"LeftTop":          ebiten.StandardGamepadButtonLeftTop,
+	"LeftBottom":       ebiten.StandardGamepadButtonLeftBottom,
+	"LeftLeft":         ebiten.StandardGamepadButtonLeftLeft,
+	"LeftRight":        ebiten.StandardGamepadButtonLeftRight,
+	"CenterCenter":     ebiten.StandardGamepadButtonCenterCenter,
+}
+
+func DefaultInputConfig() *InputConfig {
+	return &InputConfig{
+		Deadzone: 0.3,
+		Keyboard: []map[string][]string{
+			{
+				"x":     {"X", "Space"},
+				"z":     {"Y", "Z", "C"},
+				"left":  {"ArrowLeft"},
+				"right": {"ArrowRight"},
+				"up":    {"ArrowUp"},
+				"down":  {"ArrowDown"},
+			},
+			{
+				"x":     {"Q"},
+				"z":     {"Tab"},
+				"left":  {"S"},
+				"right": {"F"},
+				"up":    {"E"},
+				"down":  {"D"},
+			},
+		},
+		Gamepad: map[string][]string{
+			"x":     {"RightBottom", "RightTop"},
+			"z":     {"RightRight", "RightLeft"},
+			"left":  {"LeftLeft"},
+			"right": {"LeftRight"},
+			"up":    {"LeftTop"},
+			"down":  {"LeftBottom"},
+		},
+	}
+}
+
+// DefaultInputConfigPath returns where the input config lives in the user's
+// config directory.
+func DefaultInputConfigPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "w4g", "input.json"), nil
+}
+
+// LoadInputConfig reads the input config from name. If the file doesn't
+// exist yet, it is created with the default mapping, ready to be edited.
+func LoadInputConfig(name string) (*InputConfig, error) {
+	data, err := os.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		config := DefaultInputConfig()
+
+		data, err = json.MarshalIndent(config, "", "\t")
+		if err != nil {
+			return nil, err
+		}
+
+		err = os.MkdirAll(filepath.Dir(name), 0755)
+		if err == nil {
+			err = os.WriteFile(name, data, 0644)
+		}
+
+		return config, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// A config without a deadzone keeps the default one
+	config := &InputConfig{Deadzone: DefaultInputConfig().Deadzone}
+	err = json.Unmarshal(data, config)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	return config, nil
+}
+
+// Mapping is the resolved form of an InputConfig.
+type Mapping struct {
+	Deadzone float64
+	Keys     [4]map[ebiten.Key]byte
+	Buttons  map[ebiten.StandardGamepadButton]byte
+}
+
+// Mapping resolves the names of the config.
+func (c *InputConfig) Mapping() (*Mapping, error) {
+	if len(c.Keyboard) > 4 {
+		return nil, fmt.Errorf("keys for %d players configured, WASM-4 only has 4", len(c.Keyboard))
+	}
+
+	keys := map[string]ebiten.Key{}
+	for key := ebiten.Key(0); key <= ebiten.KeyMax; key++ {
+		keys[key.String()] = key
+	}
+
+	m := &Mapping{
+		Deadzone: c.Deadzone,
+		Buttons:  map[ebiten.StandardGamepadButton]byte{},
+	}
+
+	for player, mapping := range c.Keyboard {
+		m.Keys[player] = map[ebiten.Key]byte{}
+
+		for name, keyNames := range mapping {
+			button, ok := padButtons[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown button %q", name)
+			}
+
+			for _, keyName := range keyNames {
+				key, ok := keys[keyName]
+				if !ok {
+					return nil, fmt.Errorf("unknown key %q", keyName)
+				}
+				m.Keys[player][key] |= button
+			}
+		}
+	}
+
+	for name, buttonNames := range c.Gamepad {
+		button, ok := padButtons[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown button %q", name)
+		}
+
+		for _, buttonName := range buttonNames {
+			standard, ok := standardButtons[buttonName]
+			if !ok {
+				return nil, fmt.Errorf("unknown gamepad button %q", buttonName)
+			}
+			m.Buttons[standard] |= button
+		}
+	}
+
+	return m, nil
+}
@@ -0,0 +1,179 @@
+package frontend
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/christopher-kleine/w4g/pkg/runtime"
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+func TestMappingErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		config InputConfig
+		want   string
+	}{
+		{"unknown key button", InputConfig{Keyboard: []map[string][]string{{"a": {"A"}}}}, `unknown button "a"`},
+		{"unknown key", InputConfig{Keyboard: []map[string][]string{{"x": {"Pizza"}}}}, `unknown key "Pizza"`},
+		{"unknown gamepad button", InputConfig{Gamepad: map[string][]string{"start": {"CenterRight"}}}, `unknown button "start"`},
+		{"unknown standard button", InputConfig{Gamepad: map[string][]string{"x": {"Start"}}}, `unknown gamepad button "Start"`},
+		{"five keyboards", InputConfig{Keyboard: make([]map[string][]string, 5)}, "keys for 5 players"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := test.config.Mapping()
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got %v, want %s", err, test.want)
+			}
+		})
+	}
+}
+
+func TestMapping(t *testing.T) {
+	config := InputConfig{
+		Deadzone: 0.5,
+		Keyboard: []map[string][]string{
+			{"x": {"Space"}},
+			nil,
+			nil,
+			{
+				"left": {"ArrowLeft", "A"},
+				"up":   {"ArrowUp", "A"},
+			},
+		},
+		Gamepad: map[string][]string{
+			"x":    {"RightBottom"},
+			"z":    {"RightBottom", "RightRight"},
+			"down": {"LeftBottom"},
+		},
+	}
+
+	m, err := config.Mapping()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Deadzone != 0.5 {
+		t.Errorf("deadzone %v, want 0.5", m.Deadzone)
+	}
+
+	keys := []struct {
+		player int
+		key    ebiten.Key
+		want   byte
+	}{
+		{0, ebiten.KeySpace, runtime.PadX},
+		{0, ebiten.KeyA, 0},
+		{3, ebiten.KeyArrowLeft, runtime.PadLeft},
+		{3, ebiten.KeyArrowUp, runtime.PadUp},
+		{3, ebiten.KeyA, runtime.PadLeft | runtime.PadUp},
+		{3, ebiten.KeySpace, 0},
+	}
+	for _, k := range keys {
+		if got := m.Keys[k.player][k.key]; got != k.want {
+			t.Errorf("%s of player %d is %#x, want %#x", k.key, k.player+1, got, k.want)
+		}
+	}
+
+	buttons := []struct {
+		button ebiten.StandardGamepadButton
+		want   byte
+	}{
+		{ebiten.StandardGamepadButtonRightBottom, runtime.PadX | runtime.PadY},
+		{ebiten.StandardGamepadButtonRightRight, runtime.PadY},
+		{ebiten.StandardGamepadButtonLeftBottom, runtime.PadDown},
+		{ebiten.StandardGamepadButtonLeftTop, 0},
+	}
+	for _, b := range buttons {
+		if got := m.Buttons[b.button]; got != b.want {
+			t.Errorf("gamepad button %d is %#x, want %#x", b.button, got, b.want)
+		}
+	}
+}
+
+func TestDefaultInputConfig(t *testing.T) {
+	_, err := DefaultInputConfig().Mapping()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLoadInputConfigDeadzone(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   float64
+	}{
+		{"missing", `{"keyboard": [{"x": ["Space"]}]}`, DefaultInputConfig().Deadzone},
+		{"set", `{"deadzone": 0.6}`, 0.6},
+		{"zero", `{"deadzone": 0}`, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			name := filepath.Join(t.TempDir(), "input.json")
+			err := os.WriteFile(name, []byte(test.config), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			config, err := LoadInputConfig(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.Deadzone != test.want {
+				t.Errorf("deadzone %v, want %v", config.Deadzone, test.want)
+			}
+		})
+	}
+}
+
+func TestLoadInputConfigCreatesDefault(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "w4g", "input.json")
+
+	config, err := LoadInputConfig(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Deadzone != DefaultInputConfig().Deadzone {
+		t.Errorf("deadzone %v", config.Deadzone)
+	}
+
+	// The written default reads back the same
+	again, err := LoadInputConfig(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Deadzone != config.Deadzone || len(again.Keyboard) != len(config.Keyboard) {
+		t.Errorf("read back %+v", again)
+	}
+}
+
+func TestStickState(t *testing.T) {
+	g := &Game{Mapping: &Mapping{Deadzone: 0.3}}
+
+	tests := []struct {
+		x, y float64
+		want byte
+	}{
+		{0, 0, runtime.PadIdle},
+		{0.3, -0.3, runtime.PadIdle},
+		{-0.29, 0.29, runtime.PadIdle},
+		{0.31, 0, runtime.PadRight},
+		{-0.31, 0, runtime.PadLeft},
+		{0, -1, runtime.PadUp},
+		{0, 1, runtime.PadDown},
+		{1, 1, runtime.PadRight | runtime.PadDown},
+		{-1, -0.5, runtime.PadLeft | runtime.PadUp},
+	}
+
+	for _, test := range tests {
+		if got := g.stickState(test.x, test.y); got != test.want {
+			t.Errorf("stick at (%v, %v) is %#x, want %#x", test.x, test.y, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package frontend
+
+import (
+	"github.com/christopher-kleine/w4g/pkg/runtime"
+)
+
+// RecordMovie appends the input of every frame to m.
+func (g *Game) RecordMovie(m *runtime.Movie) {
+	g.movie = m
+	g.replaying = false
+}
+
+// ReplayMovie feeds the recorded input of m into the cart instead of the
+// players' input. Once the movie ends, the players take over.
+func (g *Game) ReplayMovie(m *runtime.Movie) {
+	g.movie = m
+	g.replaying = true
+	g.movieFrame = 0
+}
+
+// movieInput returns the input of the next frame, taking movies into
+// account.
+func (g *Game) movieInput() runtime.InputState {
+	if g.movie == nil {
+		return g.Input()
+	}
+
+	if !g.replaying {
+		input := g.Input()
+		g.movie.Frames = append(g.movie.Frames, input)
+
+		return input
+	}
+
+	if g.movieFrame >= len(g.movie.Frames) {
+		g.movie = nil
+		g.notify("END OF MOVIE")
+
+		return g.Input()
+	}
+
+	input := g.movie.Frames[g.movieFrame]
+	g.movieFrame++
+
+	return input
+}
@@ -0,0 +1,110 @@
+package frontend
+
+import (
+	"context"
+	"errors"
+	"image/color"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/christopher-kleine/w4g/pkg/runtime"
+	"github.com/christopher-kleine/w4g/pkg/watch"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+)
+
+// reloadErrorFrames is how long a failed reload is shown.
+const reloadErrorFrames = 3 * 60
+
+// EnableReload reloads the cart whenever the file name changes.
+func (g *Game) EnableReload(name string, mode runtime.ReloadMode) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	g.reloadName = name
+	g.reloadMode = mode
+	g.reloads = watch.New(name).Watch(ctx)
+	g.stopReload = cancel
+}
+
+// reload loads a new build of the cart if it changed. A build that fails
+// leaves the old one running. A new build that crashes in start replaced the
+// old one all the same, its crash is shown like any other.
+func (g *Game) reload() {
+	select {
+	case <-g.reloads:
+	default:
+		return
+	}
+
+	code, err := os.ReadFile(g.reloadName)
+	if err == nil {
+		err = g.rt.Reload(code, g.reloadMode)
+	}
+	var crash *runtime.Crash
+	if err != nil && !errors.As(err, &crash) {
+		log.Printf("reload failed: %v", err)
+		g.reloadError = err.Error()
+		g.reloadErrorFrames = reloadErrorFrames
+		return
+	}
+
+	log.Printf("reloaded %s", g.reloadName)
+	g.reloadErrorFrames = 0
+	g.crash = nil
+	if g.Rewind != nil {
+		g.Rewind.Reset()
+	}
+
+	g.notify("RELOADED")
+}
+
+// ReportBuild shows the outcome of a build of the cart in the window. A
+// failed build is shown until the next build succeeds. It is safe to call
+// from any goroutine.
+func (g *Game) ReportBuild(err error) {
+	g.buildMu.Lock()
+	defer g.buildMu.Unlock()
+
+	g.buildError = ""
+	if err != nil {
+		g.buildError = err.Error()
+	}
+}
+
+// drawBuildError tells the player why the new build didn't load, if it
+// didn't.
+func (g *Game) drawBuildError(screen *ebiten.Image) bool {
+	if g.reloadErrorFrames > 0 {
+		g.reloadErrorFrames--
+		drawError(screen, "RELOAD FAILED", g.reloadError)
+		return true
+	}
+
+	g.buildMu.Lock()
+	defer g.buildMu.Unlock()
+
+	if g.buildError != "" {
+		drawError(screen, "BUILD FAILED", g.buildError)
+		return true
+	}
+
+	return false
+}
+
+// drawError covers the picture with an error message of a new build.
+func drawError(screen *ebiten.Image, title, message string) {
+	lines := []string{title, ""}
+	for _, line := range strings.Split(message, "\n") {
+		lines = append(lines, wrap(line, crashColumns)...)
+	}
+	if len(lines) > crashLines-2 {
+		lines = lines[:crashLines-2]
+	}
+	lines = append(lines, "", "STILL RUNNING OLD BUILD")
+
+	ebitenutil.DrawRect(screen, 0, 0, runtime.WIDTH, runtime.HEIGHT, color.RGBA{R: 0x40, A: 0xc0})
+	for i, line := range lines {
+		ebitenutil.DebugPrintAt(screen, line, 0, i*16)
+	}
+}
@@ -0,0 +1,26 @@
+package frontend
+
+import (
+	"image/color"
+
+	"github.com/christopher-kleine/w4g/pkg/runtime"
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// Renderer draws a 2bpp framebuffer onto the screen. The zero value is
+// ready to use.
+type Renderer struct {
+	converter runtime.PixelConverter
+	pixels    []byte
+}
+
+// Render converts framebuffer with palette and uploads it to screen in one
+// go.
+func (r *Renderer) Render(screen *ebiten.Image, framebuffer []byte, palette [4]color.RGBA) {
+	if r.pixels == nil {
+		r.pixels = make([]byte, runtime.WIDTH*runtime.HEIGHT*4)
+	}
+
+	r.converter.Convert(r.pixels, framebuffer, palette)
+	screen.ReplacePixels(r.pixels)
+}
@@ -0,0 +1,74 @@
+package frontend
+
+import "sync"
+
+// RingBuffer is a fixed-size byte queue shared between the runtime, which
+// writes audio every tick, and the audio player, which reads from its own
+// goroutine.
+type RingBuffer struct {
+	mu    sync.Mutex
+	data  []byte
+	start int
+	size  int
+}
+
+func NewRingBuffer(capacity int) *RingBuffer {
+	return &RingBuffer{
+		data: make([]byte, capacity),
+	}
+}
+
+// Write appends p to the buffer. When the buffer is full, the oldest bytes
+// are dropped, so the buffered latency never exceeds the capacity.
+func (rb *RingBuffer) Write(p []byte) (n int, err error) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	n = len(p)
+	if len(p) > len(rb.data) {
+		p = p[len(p)-len(rb.data):]
+	}
+
+	if overflow := rb.size + len(p) - len(rb.data); overflow > 0 {
+		rb.start = (rb.start + overflow) % len(rb.data)
+		rb.size -= overflow
+	}
+
+	end := (rb.start + rb.size) % len(rb.data)
+	copied := copy(rb.data[end:], p)
+	copy(rb.data, p[copied:])
+	rb.size += len(p)
+
+	return n, nil
+}
+
+// Read fills p from the buffer. Whatever the buffer can't provide is filled
+// with silence, so Read never blocks and never returns io.EOF.
+func (rb *RingBuffer) Read(p []byte) (n int, err error) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	avail := p
+	if len(avail) > rb.size {
+		avail = avail[:rb.size]
+	}
+
+	copied := copy(avail, rb.data[rb.start:])
+	copy(avail[copied:], rb.data)
+	rb.start = (rb.start + len(avail)) % len(rb.data)
+	rb.size -= len(avail)
+
+	for i := len(avail); i < len(p); i++ {
+		p[i] = 0
+	}
+
+	return len(p), nil
+}
+
+// Len returns the number of buffered bytes.
+func (rb *RingBuffer) Len() int {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	return rb.size
+}
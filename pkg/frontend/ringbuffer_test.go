@@ -0,0 +1,111 @@
+package frontend
+
+import (
+	"bytes"
+	"testing"
+)
+
+// read reads n bytes from rb.
+func read(t *testing.T, rb *RingBuffer, n int) []byte {
+	t.Helper()
+
+	p := make([]byte, n)
+	got, err := rb.Read(p)
+	if err != nil || got != n {
+		t.Fatalf("read %d bytes, %v", got, err)
+	}
+
+	return p
+}
+
+// write writes p to rb.
+func write(t *testing.T, rb *RingBuffer, p []byte) {
+	t.Helper()
+
+	n, err := rb.Write(p)
+	if err != nil || n != len(p) {
+		t.Fatalf("wrote %d of %d bytes, %v", n, len(p), err)
+	}
+}
+
+func TestRingBufferWraparound(t *testing.T) {
+	rb := NewRingBuffer(8)
+
+	// Move the start to the middle, so the next writes wrap around
+	write(t, rb, []byte{1, 2, 3, 4, 5})
+	if got := read(t, rb, 5); !bytes.Equal(got, []byte{1, 2, 3, 4, 5}) {
+		t.Fatalf("read %v", got)
+	}
+
+	for round := byte(0); round < 4; round++ {
+		data := []byte{round, 10 + round, 20 + round, 30 + round, 40 + round, 50 + round}
+		write(t, rb, data[:4])
+		write(t, rb, data[4:])
+		if rb.Len() != len(data) {
+			t.Fatalf("round %d: %d bytes buffered, want %d", round, rb.Len(), len(data))
+		}
+
+		if got := append(read(t, rb, 1), read(t, rb, 5)...); !bytes.Equal(got, data) {
+			t.Errorf("round %d: read %v, want %v", round, got, data)
+		}
+	}
+
+	if rb.Len() != 0 {
+		t.Errorf("%d bytes left", rb.Len())
+	}
+}
+
+func TestRingBufferOverflow(t *testing.T) {
+	rb := NewRingBuffer(4)
+
+	// The oldest bytes make room for the new ones
+	write(t, rb, []byte{1, 2, 3})
+	write(t, rb, []byte{4, 5, 6})
+	if rb.Len() != 4 {
+		t.Fatalf("%d bytes buffered, want 4", rb.Len())
+	}
+	if got := read(t, rb, 4); !bytes.Equal(got, []byte{3, 4, 5, 6}) {
+		t.Errorf("read %v, want [3 4 5 6]", got)
+	}
+
+	// A write larger than the buffer keeps its end
+	write(t, rb, []byte{7})
+	write(t, rb, []byte{8, 9, 10, 11, 12, 13})
+	if got := read(t, rb, 4); !bytes.Equal(got, []byte{10, 11, 12, 13}) {
+		t.Errorf("read %v, want [10 11 12 13]", got)
+	}
+}
+
+func TestRingBufferUnderrun(t *testing.T) {
+	rb := NewRingBuffer(8)
+
+	// Reading an empty buffer is silence, whatever was in p
+	p := []byte{9, 9, 9}
+	n, err := rb.Read(p)
+	if err != nil || n != len(p) {
+		t.Fatalf("read %d bytes, %v", n, err)
+	}
+	if !bytes.Equal(p, []byte{0, 0, 0}) {
+		t.Errorf("read %v from an empty buffer", p)
+	}
+
+	// What is buffered comes first, the rest is silence
+	write(t, rb, []byte{1, 2})
+	p = []byte{9, 9, 9, 9, 9}
+	n, err = rb.Read(p)
+	if err != nil || n != len(p) {
+		t.Fatalf("read %d bytes, %v", n, err)
+	}
+	if !bytes.Equal(p, []byte{1, 2, 0, 0, 0}) {
+		t.Errorf("read %v, want [1 2 0 0 0]", p)
+	}
+	if rb.Len() != 0 {
+		t.Errorf("%d bytes left", rb.Len())
+	}
+
+	// The buffer keeps working after an underrun
+	write(t, rb, []byte{3, 4})
+	if got := read(t, rb, 2); !bytes.Equal(got, []byte{3, 4}) {
+		t.Errorf("read %v, want [3 4]", got)
+	}
+}
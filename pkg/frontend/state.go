@@ -0,0 +1,63 @@
+package frontend
+
+import (
+	"log"
+	"os"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// RewindKey plays the cart backwards while it is held.
+var RewindKey = ebiten.KeyBackspace
+
+// StateKeys load the save state slots 1 to 4. Holding shift saves into the
+// slot instead.
+var StateKeys = []ebiten.Key{
+	ebiten.KeyF1,
+	ebiten.KeyF2,
+	ebiten.KeyF3,
+	ebiten.KeyF4,
+}
+
+func (g *Game) SaveState(slot int) {
+	f, err := os.Create(g.rt.StateFile(slot))
+	if err != nil {
+		log.Println(err)
+		g.notify("SAVE %d FAILED", slot)
+		return
+	}
+	defer f.Close()
+
+	err = g.rt.SaveState(f)
+	if err != nil {
+		log.Println(err)
+		g.notify("SAVE %d FAILED", slot)
+		return
+	}
+
+	g.notify("SAVED %d", slot)
+}
+
+func (g *Game) LoadState(slot int) {
+	f, err := os.Open(g.rt.StateFile(slot))
+	if err != nil {
+		log.Println(err)
+		g.notify("NO STATE %d", slot)
+		return
+	}
+	defer f.Close()
+
+	err = g.rt.LoadState(f)
+	if err != nil {
+		log.Println(err)
+		g.notify("LOAD %d FAILED", slot)
+		return
+	}
+
+	// Rewinding past the load would mix two timelines
+	if g.Rewind != nil {
+		g.Rewind.Reset()
+	}
+
+	g.notify("LOADED %d", slot)
+}
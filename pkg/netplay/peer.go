@@ -0,0 +1,235 @@
+package netplay
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// Packet types. Every packet starts with one of them.
+const (
+	packetHello   byte = 'H' // joiner -> host: cart hash
+	packetWelcome byte = 'W' // host -> joiner: input delay, disk of the host
+	packetReject  byte = 'R' // host -> joiner: reason
+	packetInput   byte = 'I' // both ways: ack, first frame, inputs
+)
+
+const (
+	joinTimeout = 10 * time.Second
+	joinRetry   = 250 * time.Millisecond
+)
+
+var ErrRejected = errors.New("rejected by host")
+
+// Peer is the UDP connection to the other player.
+type Peer struct {
+	conn    *net.UDPConn
+	addr    *net.UDPAddr
+	delay   int
+	welcome []byte
+	packets chan []byte
+}
+
+// Host waits until a player joins on addr with the same cart. disk and the
+// input delay are sent to the joining player, so both start with the same
+// disk and delay their input alike.
+func Host(addr string, cart [sha256.Size]byte, disk []byte, delay int) (*Peer, error) {
+	err := checkDelay(delay)
+	if err != nil {
+		return nil, err
+	}
+
+	laddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.ListenUDP("udp", laddr)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Peer{
+		conn:    conn,
+		delay:   delay,
+		welcome: append([]byte{packetWelcome, byte(delay)}, disk...),
+	}
+
+	buf := make([]byte, 2048)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		packet := buf[:n]
+		if len(packet) == 0 || packet[0] != packetHello {
+			continue
+		}
+
+		if !bytes.Equal(packet[1:], cart[:]) {
+			conn.WriteToUDP(append([]byte{packetReject}, "different cart"...), from)
+			continue
+		}
+
+		p.addr = from
+		p.Send(p.welcome)
+		p.start()
+
+		return p, nil
+	}
+}
+
+// Join connects to the host at addr. It returns the disk of the host. The
+// input delay of the host is used by both players, see Delay.
+func Join(addr string, cart [sha256.Size]byte) (*Peer, []byte, error) {
+	raddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	if raddr.IP == nil || raddr.IP.IsUnspecified() {
+		raddr.IP = net.IPv4(127, 0, 0, 1)
+	}
+
+	conn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p := &Peer{
+		conn: conn,
+		addr: raddr,
+	}
+
+	hello := append([]byte{packetHello}, cart[:]...)
+	deadline := time.Now().Add(joinTimeout)
+	buf := make([]byte, 2048)
+	for time.Now().Before(deadline) {
+		p.Send(hello)
+
+		conn.SetReadDeadline(time.Now().Add(joinRetry))
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			continue
+		}
+		if !from.IP.Equal(raddr.IP) || from.Port != raddr.Port || n == 0 {
+			continue
+		}
+
+		switch buf[0] {
+		case packetWelcome:
+			if n < 2 {
+				continue
+			}
+
+			p.delay = int(buf[1])
+			err = checkDelay(p.delay)
+			if err != nil {
+				conn.Close()
+				return nil, nil, fmt.Errorf("host sent an invalid delay: %w", err)
+			}
+
+			conn.SetReadDeadline(time.Time{})
+			p.start()
+			return p, append([]byte{}, buf[2:n]...), nil
+
+		case packetReject:
+			conn.Close()
+			return nil, nil, fmt.Errorf("%w: %s", ErrRejected, buf[1:n])
+		}
+	}
+
+	conn.Close()
+
+	return nil, nil, fmt.Errorf("no answer from %s", addr)
+}
+
+// start reads packets of the peer in the background.
+func (p *Peer) start() {
+	p.packets = make(chan []byte, 64)
+
+	go func() {
+		defer close(p.packets)
+
+		buf := make([]byte, 2048)
+		for {
+			n, from, err := p.conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			if !from.IP.Equal(p.addr.IP) || from.Port != p.addr.Port || n == 0 {
+				continue
+			}
+
+			// The host answers repeated hellos, its welcome might have been lost
+			if buf[0] == packetHello && p.welcome != nil {
+				p.Send(p.welcome)
+				continue
+			}
+
+			select {
+			case p.packets <- append([]byte{}, buf[:n]...):
+			default:
+				// Inputs are sent repeatedly, dropping a packet is fine
+			}
+		}
+	}()
+}
+
+// Send sends a packet to the peer. UDP may lose it.
+func (p *Peer) Send(packet []byte) error {
+	_, err := p.conn.WriteToUDP(packet, p.addr)
+
+	return err
+}
+
+// Receive returns the next packet of the peer without blocking, or nil if
+// there is none.
+func (p *Peer) Receive() ([]byte, error) {
+	select {
+	case packet, ok := <-p.packets:
+		if !ok {
+			return nil, net.ErrClosed
+		}
+		return packet, nil
+
+	default:
+		return nil, nil
+	}
+}
+
+// Delay returns the input delay both players agreed on.
+func (p *Peer) Delay() int {
+	return p.delay
+}
+
+func (p *Peer) Close() error {
+	return p.conn.Close()
+}
+
+// encodeInput builds an input packet: the number of frames received from the
+// peer, the first frame of the inputs and the inputs themselves.
+func encodeInput(ack, first int, inputs []byte) []byte {
+	packet := make([]byte, 9, 9+len(inputs))
+	packet[0] = packetInput
+	binary.LittleEndian.PutUint32(packet[1:], uint32(ack))
+	binary.LittleEndian.PutUint32(packet[5:], uint32(first))
+
+	return append(packet, inputs...)
+}
+
+func decodeInput(packet []byte) (ack, first int, inputs []byte, ok bool) {
+	if len(packet) < 9 || packet[0] != packetInput {
+		return 0, 0, nil, false
+	}
+
+	ack = int(binary.LittleEndian.Uint32(packet[1:]))
+	first = int(binary.LittleEndian.Uint32(packet[5:]))
+
+	return ack, first, packet[9:], true
+}
@@ -0,0 +1,229 @@
+// Package netplay lets two players run the same cart on different machines.
+//
+// Both sides run the whole cart and only exchange the gamepad byte of their
+// local player. A frame doesn't wait for the input of the other player:
+// it is predicted to be the last one received. Once the real input arrives
+// and differs from the prediction, the cart is restored from the snapshot
+// taken before that frame and the frames since are run again.
+package netplay
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/christopher-kleine/w4g/pkg/runtime"
+)
+
+const (
+	// MaxRollback is how many frames a side may run ahead of the last input
+	// received from the other side before it waits.
+	MaxRollback = 8
+
+	// DefaultDelay is the number of frames local input is delayed by. It
+	// hides most of the latency without any rollback at all.
+	DefaultDelay = 2
+
+	// window is the size of the ring buffers, large enough for inputs and
+	// snapshots of all frames that could still be rolled back.
+	window = 64
+
+	// maxInputs limits the inputs sent in a single packet.
+	maxInputs = 32
+
+	timeout = 5 * time.Second
+)
+
+var ErrTimeout = errors.New("the other player stopped responding")
+
+// checkDelay rejects input delays the ring buffers can't hold. A longer
+// delay than MaxRollback would never be needed to hide the latency anyway.
+func checkDelay(delay int) error {
+	if delay < 0 || delay > MaxRollback {
+		return fmt.Errorf("input delay %d is not between 0 and %d frames", delay, MaxRollback)
+	}
+
+	return nil
+}
+
+// Session runs a cart in lockstep with a peer. The host is player 1, the
+// joining player is player 2.
+type Session struct {
+	rt    *runtime.Runtime
+	peer  *Peer
+	local int
+	delay int
+
+	// frame is the next frame to run.
+	frame int
+
+	// Inputs by frame%window. Frames before localEnd and remoteEnd are known.
+	localInputs  [window]byte
+	localEnd     int
+	remoteInputs [window]byte
+	remoteEnd    int
+
+	// predicted is the remote input a frame was run with.
+	predicted [window]byte
+
+	// states holds the state before each frame.
+	states [window]*runtime.State
+
+	// rollback is the first frame that was run with a wrong prediction, or
+	// -1 if there is none.
+	rollback int
+
+	// peerAck is the number of local inputs the peer confirmed.
+	peerAck int
+
+	lastReceived time.Time
+}
+
+// NewSession starts a session on a freshly loaded cart. host is true for the
+// player that called Host. Both players use the input delay of the host,
+// which the peer got during the handshake.
+func NewSession(rt *runtime.Runtime, peer *Peer, host bool) (*Session, error) {
+	delay := peer.Delay()
+	err := checkDelay(delay)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Session{
+		rt:           rt,
+		peer:         peer,
+		local:        1,
+		delay:        delay,
+		localEnd:     delay,
+		remoteEnd:    delay,
+		rollback:     -1,
+		lastReceived: time.Now(),
+	}
+	if host {
+		s.local = 0
+	}
+
+	return s, nil
+}
+
+// Player returns the index of the local player.
+func (s *Session) Player() int {
+	return s.local
+}
+
+// Advance runs the next frame with the input of the local player. It
+// returns false without running a frame if it is too far ahead of the peer.
+func (s *Session) Advance(input byte) (bool, error) {
+	err := s.receive()
+	if err != nil {
+		return false, err
+	}
+
+	if s.frame-s.remoteEnd >= MaxRollback {
+		s.send()
+
+		if time.Since(s.lastReceived) > timeout {
+			return false, ErrTimeout
+		}
+
+		return false, nil
+	}
+
+	s.localInputs[(s.frame+s.delay)%window] = input
+	s.localEnd = s.frame + s.delay + 1
+	s.send()
+
+	if s.rollback >= 0 {
+		err = s.rt.Restore(s.states[s.rollback%window])
+		if err != nil {
+			return false, err
+		}
+
+		for frame := s.rollback; frame < s.frame; frame++ {
+			err = s.run(frame)
+			if err != nil {
+				return false, err
+			}
+		}
+
+		s.rollback = -1
+	}
+
+	err = s.run(s.frame)
+	if err != nil {
+		return false, err
+	}
+
+	s.frame++
+
+	return true, nil
+}
+
+// run snapshots the cart and runs a single frame with the best known input.
+func (s *Session) run(frame int) error {
+	slot := frame % window
+	s.states[slot] = s.rt.Snapshot(s.states[slot])
+
+	remote := s.remoteInputs[(s.remoteEnd-1+window)%window]
+	if frame < s.remoteEnd {
+		remote = s.remoteInputs[slot]
+	}
+	s.predicted[slot] = remote
+
+	var input runtime.InputState
+	input.Gamepads[s.local] = s.localInputs[slot]
+	input.Gamepads[1-s.local] = remote
+
+	return s.rt.Step(input)
+}
+
+// send sends all local inputs the peer hasn't confirmed yet.
+func (s *Session) send() {
+	first := s.peerAck
+	if s.localEnd-first > maxInputs {
+		first = s.localEnd - maxInputs
+	}
+
+	inputs := make([]byte, 0, s.localEnd-first)
+	for frame := first; frame < s.localEnd; frame++ {
+		inputs = append(inputs, s.localInputs[frame%window])
+	}
+
+	s.peer.Send(encodeInput(s.remoteEnd, first, inputs))
+}
+
+// receive processes all pending packets of the peer.
+func (s *Session) receive() error {
+	for {
+		packet, err := s.peer.Receive()
+		if err != nil || packet == nil {
+			return err
+		}
+
+		ack, first, inputs, ok := decodeInput(packet)
+		if !ok {
+			continue
+		}
+
+		s.lastReceived = time.Now()
+
+		if ack > s.peerAck && ack <= s.localEnd {
+			s.peerAck = ack
+		}
+
+		for i, input := range inputs {
+			frame := first + i
+			if frame != s.remoteEnd {
+				continue
+			}
+
+			slot := frame % window
+			s.remoteInputs[slot] = input
+			s.remoteEnd++
+
+			if frame < s.frame && s.predicted[slot] != input && (s.rollback < 0 || frame < s.rollback) {
+				s.rollback = frame
+			}
+		}
+	}
+}
@@ -0,0 +1,334 @@
+package netplay
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/christopher-kleine/w4g/pkg/runtime"
+)
+
+// loadPadsCart runs testdata/pads.wasm, which folds the input of the first
+// two gamepads of every frame into its memory.
+func loadPadsCart(t *testing.T) (*runtime.Runtime, []byte) {
+	t.Helper()
+
+	code, err := os.ReadFile("testdata/pads.wasm")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rt, err := runtime.NewRuntime()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { rt.Close() })
+
+	rt.Storage = runtime.NewMemoryStorage(nil)
+	err = rt.LoadCart(code, "pads.wasm")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rt, code
+}
+
+// freeAddr returns a loopback address with a UDP port nobody listens on.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	return conn.LocalAddr().String()
+}
+
+type hostResult struct {
+	peer *Peer
+	err  error
+}
+
+// host runs Host in the background.
+func host(addr string, cart [sha256.Size]byte, disk []byte, delay int) <-chan hostResult {
+	result := make(chan hostResult, 1)
+	go func() {
+		peer, err := Host(addr, cart, disk, delay)
+		result <- hostResult{peer, err}
+	}()
+
+	return result
+}
+
+func TestJoinDifferentCart(t *testing.T) {
+	addr := freeAddr(t)
+	cart := sha256.Sum256([]byte("cart"))
+	hosted := host(addr, cart, []byte("disk of the host"), DefaultDelay)
+
+	_, _, err := Join(addr, sha256.Sum256([]byte("other cart")))
+	if !errors.Is(err, ErrRejected) {
+		t.Fatalf("joining with a different cart: got %v, want ErrRejected", err)
+	}
+
+	// The host keeps waiting for the right cart
+	joined, disk, err := Join(addr, cart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer joined.Close()
+
+	if string(disk) != "disk of the host" {
+		t.Errorf("got disk %q", disk)
+	}
+
+	select {
+	case result := <-hosted:
+		if result.err != nil {
+			t.Fatal(result.err)
+		}
+		result.peer.Close()
+
+	case <-time.After(5 * time.Second):
+		t.Fatal("Host didn't return")
+	}
+}
+
+func TestInputPacket(t *testing.T) {
+	packet := encodeInput(70000, 12, []byte{1, 2, 3})
+
+	ack, first, inputs, ok := decodeInput(packet)
+	if !ok || ack != 70000 || first != 12 || !bytes.Equal(inputs, []byte{1, 2, 3}) {
+		t.Errorf("decoded %d, %d, %v, %t", ack, first, inputs, ok)
+	}
+
+	for _, packet := range [][]byte{nil, packet[:8], append([]byte{packetHello}, packet[1:]...)} {
+		if _, _, _, ok := decodeInput(packet); ok {
+			t.Errorf("decoded %v", packet)
+		}
+	}
+}
+
+// player is one side of a session in a test, with the inputs it gave.
+type player struct {
+	s         *Session
+	inputs    []byte
+	rollbacks int
+}
+
+// advance runs the next frame of p, waiting for the other side if needed.
+func (p *player) advance(t *testing.T, input byte) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		// Count the mispredictions before Advance repairs them
+		err := p.s.receive()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.s.rollback >= 0 {
+			p.rollbacks++
+		}
+
+		ok, err := p.s.Advance(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok {
+			p.inputs = append(p.inputs, input)
+			return
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("stuck at frame %d", p.s.frame)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSession(t *testing.T) {
+	playSession(t, 1)
+}
+
+func TestSessionDelayOfHost(t *testing.T) {
+	// The joining player would use DefaultDelay on its own
+	playSession(t, DefaultDelay+2)
+}
+
+func TestSessionNoDelay(t *testing.T) {
+	playSession(t, 0)
+}
+
+// playSession runs a session over loopback with the host using delay. In
+// the end both sides have to be at the same frame with the same memory as
+// a local run of the same inputs.
+func playSession(t *testing.T, delay int) {
+	t.Helper()
+
+	hostRT, code := loadPadsCart(t)
+	joinRT, _ := loadPadsCart(t)
+
+	addr := freeAddr(t)
+	hosted := host(addr, hostRT.CartHash(), nil, delay)
+
+	joinPeer, _, err := Join(addr, sha256.Sum256(code))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer joinPeer.Close()
+
+	result := <-hosted
+	if result.err != nil {
+		t.Fatal(result.err)
+	}
+	defer result.peer.Close()
+
+	if joinPeer.Delay() != delay {
+		t.Fatalf("joining player got a delay of %d, want %d", joinPeer.Delay(), delay)
+	}
+
+	hostSession, err := NewSession(hostRT, result.peer, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	joinSession, err := NewSession(joinRT, joinPeer, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &player{s: hostSession}
+	j := &player{s: joinSession}
+
+	// The host runs ahead in bursts, so its predictions of the joining
+	// player's input, which changes every frame, are mostly wrong and the
+	// joining player's input arrives late.
+	frame := 0
+	for _, burst := range []int{1, 3, 5, 2, 6, 4, 1, 6, 3, 5} {
+		for i := 0; i < burst; i++ {
+			h.advance(t, byte(frame+i)*7+1)
+		}
+		time.Sleep(2 * time.Millisecond)
+		for i := 0; i < burst; i++ {
+			j.advance(t, byte(frame+i)*13^0x55)
+		}
+		time.Sleep(2 * time.Millisecond)
+		frame += burst
+	}
+
+	// The host runs at most MaxRollback frames past the last input it has
+	// of the joining player, which is delay frames ahead of it
+	ran := 0
+	for i := 0; i < 2*MaxRollback; i++ {
+		ok, err := h.s.Advance(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok {
+			h.inputs = append(h.inputs, 0)
+			ran++
+		}
+	}
+	if ran != delay+MaxRollback {
+		t.Errorf("host ran %d frames ahead, want %d", ran, delay+MaxRollback)
+	}
+	for len(j.inputs) < len(h.inputs) {
+		j.advance(t, 0)
+	}
+
+	// Without any change of the input, the last predictions hold and the
+	// corrections of earlier frames get run
+	for i := 0; i < 2*MaxRollback; i++ {
+		h.advance(t, 0)
+		time.Sleep(time.Millisecond)
+		j.advance(t, 0)
+		time.Sleep(time.Millisecond)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	for _, p := range []*player{h, j} {
+		err := p.s.receive()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.s.rollback >= 0 {
+			t.Fatalf("player %d still has to roll back to frame %d", p.s.Player()+1, p.s.rollback)
+		}
+		if p.s.remoteEnd < p.s.frame {
+			t.Fatalf("player %d misses inputs from frame %d on", p.s.Player()+1, p.s.remoteEnd)
+		}
+	}
+
+	if h.rollbacks == 0 {
+		t.Error("the host never rolled back")
+	}
+
+	hostState := hostRT.Snapshot(nil)
+	joinState := joinRT.Snapshot(nil)
+	if hostState.Frame != joinState.Frame {
+		t.Fatalf("host at frame %d, joining player at %d", hostState.Frame, joinState.Frame)
+	}
+	if !bytes.Equal(hostState.Memory, joinState.Memory) {
+		t.Error("memory differs")
+	}
+
+	// Both match a local run with the inputs each side gave, delayed
+	localRT, _ := loadPadsCart(t)
+	for frame := 0; frame < int(hostState.Frame); frame++ {
+		var input runtime.InputState
+		if frame >= delay {
+			input.Gamepads[0] = h.inputs[frame-delay]
+			input.Gamepads[1] = j.inputs[frame-delay]
+		}
+		err := localRT.Step(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(localRT.Snapshot(nil).Memory, hostState.Memory) {
+		t.Error("memory differs from a local run")
+	}
+}
+
+func TestInvalidDelay(t *testing.T) {
+	cart := sha256.Sum256([]byte("cart"))
+
+	for _, delay := range []int{-1, MaxRollback + 1, window} {
+		_, err := Host(freeAddr(t), cart, nil, delay)
+		if err == nil {
+			t.Errorf("Host accepted a delay of %d", delay)
+		}
+
+		rt, _ := loadPadsCart(t)
+		_, err = NewSession(rt, &Peer{delay: delay}, true)
+		if err == nil {
+			t.Errorf("NewSession accepted a delay of %d", delay)
+		}
+	}
+}
+
+func TestJoinInvalidDelay(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// A host that answers with a delay out of range
+	go func() {
+		buf := make([]byte, 2048)
+		_, from, err := conn.ReadFromUDP(buf)
+		if err == nil {
+			conn.WriteToUDP([]byte{packetWelcome, window}, from)
+		}
+	}()
+
+	_, _, err = Join(conn.LocalAddr().String(), sha256.Sum256([]byte("cart")))
+	if err == nil {
+		t.Error("joined with a delay of 64")
+	}
+}
@@ -0,0 +1,13 @@
+;; pads.wasm folds the first two gamepads of every frame into a checksum at
+;; 0x19a0 and counts the frames at 0x19a4, so any input that differs between
+;; two runs shows in the memory. Rebuild it with
+;; wat2wasm pads.wat -o pads.wasm
+(module
+  (import "env" "memory" (memory 1 1))
+  (func (export "update")
+    (i32.store (i32.const 0x19a0)
+      (i32.add
+        (i32.mul (i32.load (i32.const 0x19a0)) (i32.const 31))
+        (i32.load16_u (i32.const 0x16))))
+    (i32.store (i32.const 0x19a4)
+      (i32.add (i32.load (i32.const 0x19a4)) (i32.const 1)))))
@@ -1,7 +1,315 @@
 package runtime
 
-type APU struct{}
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
 
+	"github.com/christopher-kleine/w4g/pkg/tools"
+)
+
+const (
+	// SampleRate is the number of samples per second generated by the APU.
+	SampleRate = 44100
+
+	// SamplesPerFrame is the number of samples generated per frame at 60 FPS.
+	SamplesPerFrame = SampleRate / 60
+)
+
+const (
+	maxVolume         = 0x1333 // ~15% of INT16_MAX
+	maxVolumeTriangle = 0x2000 // ~25% of INT16_MAX
+)
+
+const (
+	TonePulse1   int32 = 0
+	TonePulse2   int32 = 1
+	ToneTriangle int32 = 2
+	ToneNoise    int32 = 3
+	ToneMode1    int32 = 0
+	ToneMode2    int32 = 4
+	ToneMode3    int32 = 8
+	ToneMode4    int32 = 12
+	TonePanLeft  int32 = 16
+	TonePanRight int32 = 32
+)
+
+type channel struct {
+	// Starting and ending frequency. freq2 is zero for no slide.
+	freq1, freq2 int32
+
+	// Envelope timestamps, in samples.
+	startTime   uint64
+	attackTime  uint64
+	decayTime   uint64
+	sustainTime uint64
+	releaseTime uint64
+
+	sustainVolume int32
+	peakVolume    int32
+
+	phase float64
+
+	// TonePanLeft, TonePanRight or zero for both speakers.
+	pan int32
+
+	// Pulse channels only.
+	dutyCycle float64
+
+	// Noise channel only.
+	seed       uint16
+	lastRandom int32
+}
+
+// APU is the audio processing unit. It implements the four channels of the
+// WASM-4 synthesizer: two pulse channels, a triangle channel and a noise
+// channel.
+//
+// The APU does not depend on any audio backend. Callers pull stereo samples
+// using Sample or Samples at SampleRate.
+type APU struct {
+	channels [4]channel
+
+	// The current time, in samples.
+	time uint64
+}
+
+func NewAPU() *APU {
+	apu := &APU{}
+	apu.channels[ToneNoise].seed = 0x0001
+
+	return apu
+}
+
+// Tone starts a new sound on the channel selected by flags.
+//
+// frequency packs the start frequency in the lower and the end frequency in
+// the upper 16 bits. duration packs the ADSR envelope in frames as
+// (attack << 24) | (decay << 16) | sustain | (release << 8). volume packs the
+// sustain volume in the lower and the peak volume of the attack in the
+// upper byte, both in percent. A peak volume of zero means 100%.
 func (apu *APU) Tone(frequency, duration, volume, flags int32) {
-	//log.Printf("tone: %d / %d / %d / %d", frequency, duration, volume, flags)
+	var (
+		freq1 = frequency & 0xffff
+		freq2 = (frequency >> 16) & 0xffff
+
+		sustain = uint64(duration & 0xff)
+		release = uint64((duration >> 8) & 0xff)
+		decay   = uint64((duration >> 16) & 0xff)
+		attack  = uint64((duration >> 24) & 0xff)
+
+		sustainVolume = tools.Min(volume&0xff, 100)
+		peakVolume    = tools.Min((volume>>8)&0xff, 100)
+
+		channelIdx = flags & 0x03
+		mode       = flags & 0x0c
+		pan        = flags & 0x30
+	)
+
+	ch := &apu.channels[channelIdx]
+
+	// Restart the phase if this channel wasn't already playing
+	if apu.time >= ch.releaseTime {
+		ch.phase = tools.Ternary[float64](channelIdx == ToneTriangle, 0.25, 0)
+	}
+
+	ch.freq1 = freq1
+	ch.freq2 = freq2
+	ch.startTime = apu.time
+	ch.attackTime = ch.startTime + SampleRate*attack/60
+	ch.decayTime = ch.attackTime + SampleRate*decay/60
+	ch.sustainTime = ch.decayTime + SampleRate*sustain/60
+	ch.releaseTime = ch.sustainTime + SampleRate*release/60
+
+	peak := tools.Ternary[int32](channelIdx == ToneTriangle, maxVolumeTriangle, maxVolume)
+	ch.sustainVolume = peak * sustainVolume / 100
+	ch.peakVolume = tools.Ternary(peakVolume != 0, peak*peakVolume/100, peak)
+	ch.pan = pan
+
+	switch channelIdx {
+	case TonePulse1, TonePulse2:
+		switch mode {
+		case ToneMode1:
+			ch.dutyCycle = 0.125
+		case ToneMode2:
+			ch.dutyCycle = 0.25
+		case ToneMode3:
+			ch.dutyCycle = 0.5
+		case ToneMode4:
+			ch.dutyCycle = 0.75
+		}
+
+	case ToneTriangle:
+		// Prevent popping by hard stopping the note
+		if release == 0 {
+			ch.releaseTime += SampleRate / 1000
+		}
+	}
+}
+
+// Sample mixes all channels and advances the APU by one sample.
+func (apu *APU) Sample() (left, right int16) {
+	var mixLeft, mixRight int32
+
+	for idx := range apu.channels {
+		ch := &apu.channels[idx]
+		if apu.time >= ch.releaseTime {
+			continue
+		}
+
+		sample := apu.channelSample(int32(idx), ch)
+		if ch.pan != TonePanLeft {
+			mixRight += sample
+		}
+		if ch.pan != TonePanRight {
+			mixLeft += sample
+		}
+	}
+
+	apu.time++
+
+	return clamp16(mixLeft), clamp16(mixRight)
+}
+
+// Samples fills buf with consecutive, interleaved left and right samples.
+func (apu *APU) Samples(buf []int16) {
+	for i := 0; i+1 < len(buf); i += 2 {
+		buf[i], buf[i+1] = apu.Sample()
+	}
+}
+
+func (apu *APU) channelSample(idx int32, ch *channel) int32 {
+	freq := float64(apu.frequency(ch))
+	volume := float64(apu.volume(ch))
+
+	if idx == ToneNoise {
+		ch.phase += freq * freq / 1000000
+		for ch.phase > 0 {
+			ch.phase--
+			ch.seed ^= ch.seed >> 7
+			ch.seed ^= ch.seed << 9
+			ch.seed ^= ch.seed >> 13
+			ch.lastRandom = 2*int32(ch.seed&0x1) - 1
+		}
+
+		return int32(volume) * ch.lastRandom
+	}
+
+	phaseInc := freq / SampleRate
+	ch.phase += phaseInc
+	if ch.phase >= 1 {
+		ch.phase--
+	}
+
+	if idx == ToneTriangle {
+		return int32(volume * (2*math.Abs(2*ch.phase-1) - 1))
+	}
+
+	// Map the duty cycle onto 0..1 for both halves of the pulse
+	var dutyPhase, dutyPhaseInc float64
+	if ch.phase < ch.dutyCycle {
+		dutyPhase = ch.phase / ch.dutyCycle
+		dutyPhaseInc = phaseInc / ch.dutyCycle
+	} else {
+		dutyPhase = (ch.phase - ch.dutyCycle) / (1 - ch.dutyCycle)
+		dutyPhaseInc = phaseInc / (1 - ch.dutyCycle)
+		volume = -volume
+	}
+
+	return int32(volume * polyblep(dutyPhase, dutyPhaseInc))
+}
+
+func (apu *APU) frequency(ch *channel) int32 {
+	if ch.freq2 > 0 {
+		return apu.ramp(ch.freq1, ch.freq2, ch.startTime, ch.releaseTime)
+	}
+
+	return ch.freq1
+}
+
+func (apu *APU) volume(ch *channel) int32 {
+	switch {
+	case apu.time >= ch.sustainTime:
+		return apu.ramp(ch.sustainVolume, 0, ch.sustainTime, ch.releaseTime)
+
+	case apu.time >= ch.decayTime:
+		return ch.sustainVolume
+
+	case apu.time >= ch.attackTime:
+		return apu.ramp(ch.peakVolume, ch.sustainVolume, ch.attackTime, ch.decayTime)
+
+	default:
+		return apu.ramp(0, ch.peakVolume, ch.startTime, ch.attackTime)
+	}
+}
+
+// ramp interpolates between value1 and value2 while the APU time moves from
+// time1 to time2.
+func (apu *APU) ramp(value1, value2 int32, time1, time2 uint64) int32 {
+	if apu.time >= time2 {
+		return value2
+	}
+
+	t := float64(apu.time-time1) / float64(time2-time1)
+
+	return value1 + int32(t*float64(value2-value1))
+}
+
+func clamp16(v int32) int16 {
+	return int16(tools.Max(math.MinInt16, tools.Min(v, math.MaxInt16)))
+}
+
+// polyblep smooths the edges of the pulse wave to reduce aliasing.
+func polyblep(phase, phaseInc float64) float64 {
+	switch {
+	case phase < phaseInc:
+		t := phase / phaseInc
+		return t + t - t*t
+
+	case phase > 1-phaseInc:
+		t := (phase - (1 - phaseInc)) / phaseInc
+		return 1 - (t + t - t*t)
+
+	default:
+		return 1
+	}
+}
+
+func (ch *channel) fields() []any {
+	return []any{
+		&ch.freq1, &ch.freq2,
+		&ch.startTime, &ch.attackTime, &ch.decayTime, &ch.sustainTime, &ch.releaseTime,
+		&ch.sustainVolume, &ch.peakVolume,
+		&ch.phase, &ch.pan, &ch.dutyCycle,
+		&ch.seed, &ch.lastRandom,
+	}
+}
+
+// MarshalBinary encodes the state of all channels, so a running sound
+// continues seamlessly after restoring a save state.
+func (apu *APU) MarshalBinary() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	binary.Write(buf, binary.LittleEndian, apu.time)
+	for i := range apu.channels {
+		for _, field := range apu.channels[i].fields() {
+			binary.Write(buf, binary.LittleEndian, field)
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (apu *APU) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+	err := binary.Read(r, binary.LittleEndian, &apu.time)
+	for i := range apu.channels {
+		for _, field := range apu.channels[i].fields() {
+			if err != nil {
+				return err
+			}
+			err = binary.Read(r, binary.LittleEndian, field)
+		}
+	}
+
+	return err
 }
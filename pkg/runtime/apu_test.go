@@ -0,0 +1,314 @@
+package runtime
+
+import (
+	"math"
+	"testing"
+)
+
+// near allows for the last bit the float math of the channels may round
+// differently on platforms that fuse multiply-adds.
+func near(got, want int32) bool {
+	diff := got - want
+	return diff >= -1 && diff <= 1
+}
+
+// samples returns the next n samples of the left speaker.
+func samples(apu *APU, n int) []int16 {
+	result := make([]int16, n)
+	for i := range result {
+		result[i], _ = apu.Sample()
+	}
+
+	return result
+}
+
+func TestPulseDutyCycle(t *testing.T) {
+	// At 441 Hz a period takes 100 samples. The last one of the period
+	// wraps around to the rising edge and is silent.
+	tests := []struct {
+		mode     int32
+		high     int
+		low      int
+		lastHigh int
+	}{
+		{ToneMode1, 12, 87, 10},
+		{ToneMode2, 24, 74, 23},
+		{ToneMode3, 49, 49, 48},
+		{ToneMode4, 74, 24, 73},
+	}
+
+	for _, test := range tests {
+		apu := NewAPU()
+		apu.Tone(441, 60, 100, TonePulse1|test.mode)
+		period := samples(apu, 100)
+
+		var high, low int
+		for _, sample := range period {
+			switch {
+			case sample > 0:
+				high++
+			case sample < 0:
+				low++
+			}
+		}
+		if high != test.high || low != test.low {
+			t.Errorf("mode %d is %d samples high and %d low, want %d and %d", test.mode>>2+1, high, low, test.high, test.low)
+		}
+
+		// Away from the edges the pulse is at full volume
+		for _, i := range []int{0, test.lastHigh / 2, test.lastHigh} {
+			if !near(int32(period[i]), maxVolume) {
+				t.Errorf("mode %d: sample %d is %d, want %d", test.mode>>2+1, i, period[i], maxVolume)
+			}
+		}
+		if !near(int32(period[test.lastHigh+5]), -maxVolume) {
+			t.Errorf("mode %d: sample %d is %d, want %d", test.mode>>2+1, test.lastHigh+5, period[test.lastHigh+5], -maxVolume)
+		}
+	}
+}
+
+func TestPulseChannelsMix(t *testing.T) {
+	apu := NewAPU()
+	apu.Tone(441, 60, 100, TonePulse1|ToneMode3)
+	apu.Tone(441, 60, 100, TonePulse2|ToneMode3)
+
+	if left, right := apu.Sample(); left != 2*maxVolume || right != 2*maxVolume {
+		t.Errorf("got %d, %d, want %d", left, right, 2*maxVolume)
+	}
+}
+
+func TestTriangle(t *testing.T) {
+	apu := NewAPU()
+	apu.Tone(441, 60, 100, ToneTriangle)
+	period := samples(apu, 100)
+
+	// The phase starts at 0.25 and advances by 0.01 per sample
+	tests := []struct {
+		sample int
+		want   int32
+	}{
+		{0, -327}, // 0.26
+		{1, -655}, // 0.27
+		{24, -maxVolumeTriangle},
+		{49, 0},
+		{73, 7864}, // 0.99
+		{99, 0},    // 0.25 again
+	}
+
+	for _, test := range tests {
+		if got := int32(period[test.sample]); !near(got, test.want) {
+			t.Errorf("sample %d is %d, want %d", test.sample, got, test.want)
+		}
+	}
+}
+
+func TestTriangleKeepsPhase(t *testing.T) {
+	apu := NewAPU()
+	apu.Tone(441, 60, 100, ToneTriangle)
+	samples(apu, 10)
+
+	// A new note on a playing channel continues the wave
+	apu.Tone(441, 60, 100, ToneTriangle)
+	if got := int32(samples(apu, 1)[0]); !near(got, -3604) {
+		t.Errorf("sample is %d, want -3604", got)
+	}
+}
+
+func TestNoise(t *testing.T) {
+	// The xorshift state after each of the first steps from seed 1
+	seeds := []uint16{
+		0x0201, 0x0805, 0x2214, 0x8254, 0x2351, 0x0d17, 0x170d, 0x5121,
+		0x5781, 0x0b2e, 0x7b3b, 0xe1ca, 0xf20e, 0x27eb, 0x6fa7, 0x9f7c,
+	}
+
+	// At 1000 Hz the noise advances exactly once per sample
+	apu := NewAPU()
+	apu.Tone(1000, 60, 100, ToneNoise)
+
+	for i, sample := range samples(apu, len(seeds)) {
+		want := int16(maxVolume)
+		if seeds[i]&1 == 0 {
+			want = -maxVolume
+		}
+		if sample != want {
+			t.Errorf("sample %d is %d, want %d", i, sample, want)
+		}
+	}
+
+	if seed := apu.channels[ToneNoise].seed; seed != seeds[len(seeds)-1] {
+		t.Errorf("seed is %#04x, want %#04x", seed, seeds[len(seeds)-1])
+	}
+}
+
+func TestEnvelope(t *testing.T) {
+	// One frame each of attack, decay, sustain and release, a peak of 100%
+	// and a sustain volume of 50%
+	apu := NewAPU()
+	apu.Tone(441, 1<<24|1<<16|1<<8|1, 100<<8|50, TonePulse1)
+
+	ch := &apu.channels[TonePulse1]
+	if ch.attackTime != 735 || ch.decayTime != 1470 || ch.sustainTime != 2205 || ch.releaseTime != 2940 {
+		t.Fatalf("envelope at %d, %d, %d, %d", ch.attackTime, ch.decayTime, ch.sustainTime, ch.releaseTime)
+	}
+
+	tests := []struct {
+		time uint64
+		want int32
+	}{
+		{0, 0},
+		{367, 2454},
+		{734, 4908},
+		{735, maxVolume},
+		{1102, 3688},
+		{1470, maxVolume / 2},
+		{2204, maxVolume / 2},
+		{2205, maxVolume / 2},
+		{2572, 1231},
+		{2939, 4},
+		{2940, 0},
+	}
+
+	for _, test := range tests {
+		apu.time = test.time
+		if got := apu.volume(ch); got != test.want {
+			t.Errorf("volume at %d is %d, want %d", test.time, got, test.want)
+		}
+	}
+
+	// Once released, the channel is silent
+	apu.time = 2940
+	if left, right := apu.Sample(); left != 0 || right != 0 {
+		t.Errorf("released channel plays %d, %d", left, right)
+	}
+}
+
+func TestEnvelopePeakVolume(t *testing.T) {
+	tests := []struct {
+		volume int32
+		peak   int32
+		want   int32
+	}{
+		{50, 0, maxVolume},
+		{50, 50, maxVolume / 2},
+		{50, 200, maxVolume},
+		{200, 0, maxVolume},
+	}
+
+	for _, test := range tests {
+		apu := NewAPU()
+		apu.Tone(441, 60, test.peak<<8|test.volume, TonePulse1)
+		if got := apu.channels[TonePulse1].peakVolume; got != test.want {
+			t.Errorf("volume %d, peak %d: peak volume is %d, want %d", test.volume, test.peak, got, test.want)
+		}
+	}
+}
+
+func TestFrequencySlide(t *testing.T) {
+	// A slide from 200 to 400 Hz over one second
+	apu := NewAPU()
+	apu.Tone(400<<16|200, 60, 100, TonePulse1)
+	ch := &apu.channels[TonePulse1]
+
+	tests := []struct {
+		time uint64
+		want int32
+	}{
+		{0, 200},
+		{11025, 250},
+		{22050, 300},
+		{44099, 399},
+		{44100, 400},
+		{50000, 400},
+	}
+
+	for _, test := range tests {
+		apu.time = test.time
+		if got := apu.frequency(ch); got != test.want {
+			t.Errorf("frequency at %d is %d, want %d", test.time, got, test.want)
+		}
+	}
+
+	// Without freq2 the frequency stays
+	apu = NewAPU()
+	apu.Tone(200, 60, 100, TonePulse1)
+	apu.time = 22050
+	if got := apu.frequency(&apu.channels[TonePulse1]); got != 200 {
+		t.Errorf("frequency is %d, want 200", got)
+	}
+}
+
+func TestPan(t *testing.T) {
+	tests := []struct {
+		pan         int32
+		left, right bool
+	}{
+		{0, true, true},
+		{TonePanLeft, true, false},
+		{TonePanRight, false, true},
+	}
+
+	for _, test := range tests {
+		apu := NewAPU()
+		apu.Tone(1000, 60, 100, ToneNoise|test.pan)
+		left, right := apu.Sample()
+		if (left != 0) != test.left || (right != 0) != test.right {
+			t.Errorf("pan %d plays %d, %d", test.pan, left, right)
+		}
+	}
+}
+
+func TestClamp16(t *testing.T) {
+	tests := []struct {
+		v    int32
+		want int16
+	}{
+		{0, 0},
+		{-1, -1},
+		{math.MaxInt16, math.MaxInt16},
+		{math.MaxInt16 + 1, math.MaxInt16},
+		{math.MinInt16, math.MinInt16},
+		{math.MinInt16 - 1, math.MinInt16},
+		{math.MaxInt32, math.MaxInt16},
+		{math.MinInt32, math.MinInt16},
+	}
+
+	for _, test := range tests {
+		if got := clamp16(test.v); got != test.want {
+			t.Errorf("clamp16(%d) is %d, want %d", test.v, got, test.want)
+		}
+	}
+}
+
+func TestAPUMarshalBinary(t *testing.T) {
+	apu := NewAPU()
+	apu.Tone(300<<16|100, 1<<24|30, 80, TonePulse1|ToneMode2|TonePanLeft)
+	apu.Tone(523, 20|10<<8, 60, TonePulse2|ToneMode4)
+	apu.Tone(220, 60, 100, ToneTriangle|TonePanRight)
+	apu.Tone(1500, 40, 50, ToneNoise)
+	samples(apu, 1000)
+
+	data, err := apu.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restored := NewAPU()
+	err = restored.UnmarshalBinary(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := make([]int16, 2*SampleRate)
+	got := make([]int16, len(want))
+	apu.Samples(want)
+	restored.Samples(got)
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("sample %d is %d, want %d", i, got[i], want[i])
+		}
+	}
+
+	if err := restored.UnmarshalBinary(data[:len(data)-1]); err == nil {
+		t.Error("truncated data accepted")
+	}
+}
@@ -0,0 +1,260 @@
+package runtime
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/christopher-kleine/w4g/pkg/wasm"
+)
+
+const (
+	// crashInputs is the number of frames whose input a crash report keeps.
+	crashInputs = 600
+
+	// crashTraces is the number of trace messages a crash report keeps.
+	crashTraces = 100
+)
+
+// Crash describes a cart that stopped because start or update failed, most
+// likely with a Trap. A crashed cart doesn't run anymore until a state is
+// restored.
+type Crash struct {
+	Cart string
+	Hash [sha256.Size]byte
+	Time time.Time
+
+	// Frame is the number of the frame that failed. Crashes in start happen
+	// in frame 0.
+	Frame uint64
+
+	// Reason is the error message without the stack trace.
+	Reason string
+
+	// Stack lists the functions that were running, the innermost first.
+	Stack []string
+
+	// Memory is a copy of the memory when the cart crashed.
+	Memory []byte
+
+	// Inputs holds the input of the last frames, the oldest first. The last
+	// one is the input of the crashed frame.
+	Inputs []InputState
+
+	// Trace holds the last trace messages of the cart.
+	Trace []TraceEntry
+
+	err error
+}
+
+func (c *Crash) Error() string {
+	return fmt.Sprintf("%s crashed in frame %d: %s", c.Cart, c.Frame, c.Reason)
+}
+
+func (c *Crash) Unwrap() error {
+	return c.err
+}
+
+// Crash returns the crash that stopped the cart, or nil if it is running.
+func (rt *Runtime) Crash() *Crash {
+	return rt.crash
+}
+
+// crashed stops the cart after start or update returned err.
+func (rt *Runtime) crashed(err error) *Crash {
+	reason, stack := splitStackTrace(err.Error())
+
+	crash := &Crash{
+		Cart:   rt.cartName,
+		Hash:   rt.cartHash,
+		Time:   time.Now(),
+		Frame:  rt.frame,
+		Reason: reason,
+		Stack:  symbolize(stack, rt.functions),
+		Trace:  rt.recentTrace.Entries(),
+		err:    err,
+	}
+
+	mem := rt.cart.Memory()
+	data, _ := mem.Read(0, mem.Size())
+	crash.Memory = append([]byte{}, data...)
+
+	first := rt.inputsFrom
+	if rt.inputsEnd > crashInputs && rt.inputsEnd-crashInputs > first {
+		first = rt.inputsEnd - crashInputs
+	}
+	for frame := first; frame < rt.inputsEnd; frame++ {
+		crash.Inputs = append(crash.Inputs, rt.inputs[frame%crashInputs])
+	}
+
+	rt.crash = crash
+
+	return crash
+}
+
+// recordInput remembers the input of the next frame for crash reports.
+func (rt *Runtime) recordInput(input InputState) {
+	rt.inputs[rt.frame%crashInputs] = input
+	rt.inputsEnd = rt.frame + 1
+}
+
+// forgetInputs keeps the recorded inputs consistent when the cart jumps to
+// another frame. Going back keeps the inputs of the frames before, anything
+// else starts over.
+func (rt *Runtime) forgetInputs(frame uint64) {
+	if frame < rt.inputsFrom || frame > rt.inputsEnd {
+		rt.inputsFrom = frame
+	}
+	rt.inputsEnd = frame
+}
+
+// splitStackTrace separates the message of an error returned by wazero from
+// the stack trace it appends.
+func splitStackTrace(msg string) (string, []string) {
+	reason, trace, found := strings.Cut(msg, "\nwasm stack trace:\n")
+	reason = strings.TrimSuffix(reason, " (recovered by wazero)")
+	if !found {
+		return reason, nil
+	}
+
+	var stack []string
+	for _, line := range strings.Split(trace, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			stack = append(stack, line)
+		}
+	}
+
+	return reason, stack
+}
+
+// functionNames returns the names of the functions of a cart, or nil if it
+// can't be parsed.
+func functionNames(code []byte) map[uint32]string {
+	m, err := wasm.Parse(code)
+	if err != nil {
+		return nil
+	}
+
+	return m.FunctionNames()
+}
+
+// unnamedFrame matches the frames wazero couldn't name, like ".$12()".
+var unnamedFrame = regexp.MustCompile(`^(.*)\.\$(\d+)\(`)
+
+// symbolize names the frames of a stack trace that wazero only knows by
+// index.
+func symbolize(stack []string, names map[uint32]string) []string {
+	for i, frame := range stack {
+		match := unnamedFrame.FindStringSubmatchIndex(frame)
+		if match == nil {
+			continue
+		}
+
+		idx, err := strconv.ParseUint(frame[match[4]:match[5]], 10, 32)
+		if err != nil {
+			continue
+		}
+
+		if name, ok := names[uint32(idx)]; ok {
+			stack[i] = frame[match[2]:match[3]] + "." + name + frame[match[5]:]
+		}
+	}
+
+	return stack
+}
+
+// WriteReport writes a plain text report of the crash, meant to be attached
+// to bug reports. Together with the cart, the memory and the inputs are
+// usually enough to reproduce the crash.
+func (c *Crash) WriteReport(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintf(bw, "w4g crash report\n\n")
+	fmt.Fprintf(bw, "Cart:    %s\n", c.Cart)
+	fmt.Fprintf(bw, "SHA-256: %x\n", c.Hash)
+	fmt.Fprintf(bw, "Time:    %s\n", c.Time.Format(time.RFC3339))
+	fmt.Fprintf(bw, "Frame:   %d\n", c.Frame)
+
+	fmt.Fprintf(bw, "\nReason:\n    %s\n", c.Reason)
+
+	fmt.Fprintf(bw, "\nStack trace:\n")
+	for _, frame := range c.Stack {
+		fmt.Fprintf(bw, "    %s\n", frame)
+	}
+
+	fmt.Fprintf(bw, "\nInputs (gamepads 1-4, mouse x, mouse y, mouse buttons):\n")
+	first := c.Frame + 1 - uint64(len(c.Inputs))
+	for i, input := range c.Inputs {
+		fmt.Fprintf(bw, "    %8d: %02x %02x %02x %02x %4d %4d %02x\n",
+			first+uint64(i),
+			input.Gamepads[0], input.Gamepads[1], input.Gamepads[2], input.Gamepads[3],
+			input.MouseX, input.MouseY, input.MouseButtons,
+		)
+	}
+
+	fmt.Fprintf(bw, "\nTrace log:\n")
+	for _, entry := range c.Trace {
+		fmt.Fprintf(bw, "    %s\n", entry)
+	}
+
+	fmt.Fprintf(bw, "\nMemory:\n")
+	dumpMemory(bw, c.Memory)
+
+	return bw.Flush()
+}
+
+// dumpMemory writes mem as a hex dump. Repeated lines are collapsed into a
+// single '*', like hexdump does.
+func dumpMemory(w io.Writer, mem []byte) {
+	const width = 16
+
+	var last []byte
+	skipping := false
+	for offset := 0; offset < len(mem); offset += width {
+		end := offset + width
+		if end > len(mem) {
+			end = len(mem)
+		}
+		line := mem[offset:end]
+
+		if last != nil && bytes.Equal(line, last) {
+			if !skipping {
+				fmt.Fprintln(w, "*")
+				skipping = true
+			}
+			continue
+		}
+		last = line
+		skipping = false
+
+		fmt.Fprintf(w, "%08x ", offset)
+		for i := 0; i < width; i++ {
+			if i%8 == 0 {
+				fmt.Fprint(w, " ")
+			}
+			if i < len(line) {
+				fmt.Fprintf(w, "%02x ", line[i])
+			} else {
+				fmt.Fprint(w, "   ")
+			}
+		}
+
+		fmt.Fprint(w, " |")
+		for _, b := range line {
+			if b < 0x20 || b > 0x7e {
+				b = '.'
+			}
+			fmt.Fprintf(w, "%c", b)
+		}
+		fmt.Fprintln(w, "|")
+	}
+
+	fmt.Fprintf(w, "%08x\n", len(mem))
+}
@@ -0,0 +1,58 @@
+package runtime
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestStackTrace(t *testing.T) {
+	msg := "blit: invalid sprite: 16 bytes at 0xfffa are outside of the memory (recovered by wazero)\n" +
+		"wasm stack trace:\n" +
+		"\tgoenv.blit(i32,i32,i32,i32,i32,i32)\n" +
+		"\t.$3(i32)\n" +
+		"\t.$4()\n" +
+		"\t.$9()"
+
+	reason, stack := splitStackTrace(msg)
+	if want := "blit: invalid sprite: 16 bytes at 0xfffa are outside of the memory"; reason != want {
+		t.Errorf("reason is %q, want %q", reason, want)
+	}
+
+	stack = symbolize(stack, map[uint32]string{3: "draw_player", 4: "update"})
+	want := []string{
+		"goenv.blit(i32,i32,i32,i32,i32,i32)",
+		".draw_player(i32)",
+		".update()",
+		".$9()",
+	}
+	if !reflect.DeepEqual(stack, want) {
+		t.Errorf("stack is %q, want %q", stack, want)
+	}
+}
+
+func TestCrashUnwrapsTrap(t *testing.T) {
+	crash := &Crash{err: &Trap{Function: "text", Argument: "str"}}
+
+	var trap *Trap
+	if !errors.As(crash, &trap) || trap.Function != "text" {
+		t.Errorf("crash doesn't unwrap to its trap")
+	}
+}
+
+func TestDumpMemory(t *testing.T) {
+	mem := make([]byte, 0x48)
+	copy(mem[0x40:], "w4g!")
+
+	var buf bytes.Buffer
+	dumpMemory(&buf, mem)
+
+	want := "00000000  00 00 00 00 00 00 00 00  00 00 00 00 00 00 00 00  |................|\n" +
+		"*\n" +
+		"00000040  77 34 67 21 00 00 00 00                           |w4g!....|\n" +
+		"00000048\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%swant\n%s", got, want)
+	}
+}
@@ -2,6 +2,8 @@ package runtime
 
 import (
 	"context"
+	"encoding/binary"
+	"unicode/utf16"
 
 	"github.com/tetratelabs/wazero/api"
 )
@@ -15,11 +17,7 @@ func (rt *Runtime) blit(_ context.Context, mod api.Module, params []uint64) {
 	height := int32(params[4])
 	flags := int32(params[5])
 
-	var srcX, srcY int32
-	stride := width
-
-	spriteBuf, _ := mod.Memory().Read(uint32(sprite), uint32(stride*(srcY+height)))
-	rt.blitFB(spriteBuf, x, y, width, height, srcX, srcY, stride, flags)
+	rt.blitFB(mod.Memory(), "blit", sprite, x, y, width, height, 0, 0, width, flags)
 }
 
 // blitSub copies a subregion within a larger sprite atlas to the
@@ -35,17 +33,37 @@ func (rt *Runtime) blitSub(_ context.Context, mod api.Module, params []uint64) {
 	stride := int32(params[7])
 	flags := int32(params[8])
 
-	spriteBuf, _ := mod.Memory().Read(uint32(sprite), uint32(stride*(srcY+height)))
-	rt.blitFB(spriteBuf, x, y, width, height, srcX, srcY, stride, flags)
+	rt.blitFB(mod.Memory(), "blitSub", sprite, x, y, width, height, srcX, srcY, stride, flags)
 }
 
-func (rt *Runtime) blitFB(sprite []byte, x, y, width, height, srcX, srcY, stride, flags int32) {
+func (rt *Runtime) blitFB(mem api.Memory, function string, sprite, x, y, width, height, srcX, srcY, stride, flags int32) {
+	checkLength(function, "width", width)
+	checkLength(function, "height", height)
+	checkLength(function, "srcX", srcX)
+	checkLength(function, "srcY", srcY)
+	checkLength(function, "stride", stride)
+
+	if width == 0 || height == 0 {
+		return
+	}
+
 	bpp2 := flags&1 == 1
 	flipX := flags&2 == 2
 	flipY := flags&4 == 4
 	rotate := flags&8 == 8
 
-	rt.VPU.Blit(sprite, x, y, width, height, srcX, srcY, stride, bpp2, flipX, flipY, rotate)
+	// The sprite has to reach up to the last pixel that is drawn
+	bits := (int64(srcY)+int64(height)-1)*int64(stride) + int64(srcX) + int64(width)
+	if bpp2 {
+		bits *= 2
+	}
+	size := (bits + 7) / 8
+	if size > int64(mem.Size()) {
+		trap(function, "sprite", "%d bytes are larger than the memory", size)
+	}
+	spriteBuf := readMemory(mem, function, "sprite", sprite, uint32(size))
+
+	rt.VPU.Blit(spriteBuf, x, y, width, height, srcX, srcY, stride, bpp2, flipX, flipY, rotate)
 }
 
 // line draws a line between two points.
@@ -68,12 +86,14 @@ func (rt *Runtime) hline(_ context.Context, params []uint64) {
 	y := int32(params[1])
 	len := int32(params[2])
 
+	checkLength("hline", "len", len)
+
 	dc0 := rt.GetColorByIndex(0)
 	if dc0 == 0 {
 		return
 	}
 	strokeColor := (dc0 - 1) & 0x3
-	rt.VPU.unclippedHLine(strokeColor, x, y, len)
+	rt.VPU.unclippedHLine(strokeColor, x, y, x+len)
 }
 
 // vline draws a vertical line.
@@ -82,11 +102,12 @@ func (rt *Runtime) vline(_ context.Context, params []uint64) {
 	y := int32(params[1])
 	len := int32(params[2])
 
+	checkLength("vline", "len", len)
+
 	dc0 := rt.GetColorByIndex(0)
 	if dc0 == 0 {
 		return
 	}
-	// strokeColor := (dc0 - 1) & 0x3
 	rt.VPU.VLine(dc0, x, y, len)
 }
 
@@ -97,6 +118,9 @@ func (rt *Runtime) oval(_ context.Context, params []uint64) {
 	width := int32(params[2])
 	height := int32(params[3])
 
+	checkLength("oval", "width", width)
+	checkLength("oval", "height", height)
+
 	fillColor := rt.GetColorByIndex(0)
 	strokeColor := rt.GetColorByIndex(1)
 
@@ -110,6 +134,9 @@ func (rt *Runtime) rect(_ context.Context, params []uint64) {
 	width := int32(params[2])
 	height := int32(params[3])
 
+	checkLength("rect", "width", width)
+	checkLength("rect", "height", height)
+
 	fillColor := rt.GetColorByIndex(0)
 	strokeColor := rt.GetColorByIndex(1)
 
@@ -123,7 +150,7 @@ func (rt *Runtime) text(_ context.Context, mod api.Module, params []uint64) {
 	x := int32(params[1])
 	y := int32(params[2])
 
-	rt.VPU.Text(getString(mod.Memory(), str), x, y)
+	rt.VPU.Text(getString(mod.Memory(), "text", "str", str), x, y)
 }
 
 // textUtf8 draws text using the built-in system font from a UTF-8 encoded
@@ -134,9 +161,10 @@ func (rt *Runtime) textUtf8(_ context.Context, mod api.Module, params []uint64)
 	x := int32(params[2])
 	y := int32(params[3])
 
-	if s, ok := mod.Memory().Read(uint32(str), uint32(byteLength)); ok {
-		rt.VPU.Text(s, x, y)
-	}
+	checkLength("textUtf8", "byteLength", byteLength)
+	s := readMemory(mod.Memory(), "textUtf8", "str", str, uint32(byteLength))
+
+	rt.VPU.Text(fontText([]rune(string(s))), x, y)
 }
 
 // textUtf16 draws text using the built-in system font from a UTF-16 encoded
@@ -147,18 +175,14 @@ func (rt *Runtime) textUtf16(_ context.Context, mod api.Module, params []uint64)
 	x := int32(params[2])
 	y := int32(params[3])
 
-	if s, ok := mod.Memory().Read(uint32(str), uint32(byteLength)); ok {
-		text := []byte(string(s))
-		endText := make([]byte, len(text)/2)
-		for i := 0; i < len(text); i += 2 {
-			endText[i/2] = text[i]
-		}
-		rt.VPU.Text(endText, x, y)
-	}
+	checkLength("textUtf16", "byteLength", byteLength)
+	s := readMemory(mod.Memory(), "textUtf16", "str", str, uint32(byteLength))
+
+	rt.VPU.Text(fontText(decodeUtf16(s)), x, y)
 }
 
 func (rt *Runtime) GetColorByIndex(index int) byte {
-	drawColors, _ := rt.cart.Memory().Read(MemDrawColors, SizeDrawColors)
+	drawColors := rt.VPU.drawColors
 	switch index {
 	case 0:
 		return drawColors[0] & 0xf
@@ -170,19 +194,35 @@ func (rt *Runtime) GetColorByIndex(index int) byte {
 		return drawColors[1] & 0xf
 
 	default:
-		return (drawColors[2] >> 4) & 0xf0
+		return (drawColors[1] >> 4) & 0xf
 	}
 }
 
-func getString(mem api.Memory, txt int32) []byte {
-	letter, _ := mem.ReadByte(uint32(txt))
-	text := make([]byte, 0)
-	offset := 0
-	for letter != 0 {
-		text = append(text, letter)
-		offset++
-		letter, _ = mem.ReadByte(uint32(txt) + uint32(offset))
+// replacementGlyph is drawn for characters the font doesn't have.
+const replacementGlyph = '?'
+
+// fontText maps characters onto the font, which follows Latin-1. The C1
+// control characters, 0x80 to 0x9f, hold the button glyphs in the font, so
+// they are only reached through text.
+func fontText(runes []rune) []byte {
+	text := make([]byte, len(runes))
+	for i, r := range runes {
+		if r > 0xff || (r >= 0x80 && r <= 0x9f) {
+			r = replacementGlyph
+		}
+		text[i] = byte(r)
 	}
 
 	return text
 }
+
+// decodeUtf16 decodes little-endian UTF-16, as used by AssemblyScript.
+// Unpaired surrogates become U+FFFD.
+func decodeUtf16(data []byte) []rune {
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(data[i*2:])
+	}
+
+	return utf16.Decode(units)
+}
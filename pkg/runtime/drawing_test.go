@@ -0,0 +1,78 @@
+package runtime
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDecodeUtf16(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"empty", nil, ""},
+		{"ascii", []byte{'H', 0, 'i', 0}, "Hi"},
+		{"latin1", []byte{0xe9, 0x00}, "é"},
+		{"surrogate pair", []byte{0x3d, 0xd8, 0x00, 0xde}, "\U0001f600"},
+		{"unpaired high surrogate", []byte{0x3d, 0xd8, 'A', 0}, "�A"},
+		{"unpaired low surrogate", []byte{'A', 0, 0x00, 0xde}, "A�"},
+		{"high surrogate at the end", []byte{'A', 0, 0x3d, 0xd8}, "A�"},
+		{"odd length", []byte{'H', 0, 'i', 0, '!'}, "Hi"},
+		{"single byte", []byte{'H'}, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := string(decodeUtf16(test.data)); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFontText(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"ascii", "Hi!", "Hi!"},
+		{"control characters", "a\nb\x00", "a\nb\x00"},
+		{"latin1", "é£ÿ\u00a0", "\xe9\xa3\xff\xa0"},
+		{"c1 controls", "\u0080\u0085\u009f", "???"},
+		{"beyond latin1", "€\U0001f600", "??"},
+		{"replacement character", "�", "?"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := string(fontText([]rune(test.text))); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestTextUtf8ButtonGlyphs(t *testing.T) {
+	rt, mod := newTestRuntime(t)
+	mod.Memory().WriteUint16Le(MemDrawColors, 0x0004)
+
+	// U+0080 is a control character, not the X button of the font
+	mod.Memory().Write(0x2000, []byte("\u0080"))
+	rt.textUtf8(context.TODO(), mod, []uint64{0x2000, 2, 0, 0})
+	got := dump(rt.VPU, 0, 0, 8, 8)
+
+	rt.VPU.Clear()
+	rt.VPU.Text([]byte{replacementGlyph}, 0, 0)
+	if want := dump(rt.VPU, 0, 0, 8, 8); got != want {
+		t.Errorf("got\n%swant\n%s", got, want)
+	}
+
+	rt.VPU.Clear()
+	mod.Memory().Write(0x2000, []byte{0x80, 0})
+	rt.text(context.TODO(), mod, []uint64{0x2000, 0, 0})
+	if dump(rt.VPU, 0, 0, 8, 8) == got {
+		t.Error("text doesn't draw the X button for 0x80")
+	}
+}
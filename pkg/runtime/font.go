@@ -1,5 +1,12 @@
 package runtime
 
+// fontFirst is the first character of the font. It covers everything up to
+// 0xff: ASCII, the gamepad buttons X, Z, left, right, up and down at 0x80,
+// 0x81 and 0x84 to 0x87, and the accented letters of Latin-1.
+const fontFirst = 0x20
+
+// font holds an 8x8 glyph per character, one byte per row, with the ink as
+// unset bits.
 var font = []byte{
 	0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
 	0xc7, 0xc7, 0xc7, 0xcf, 0xcf, 0xff, 0xcf, 0xff,
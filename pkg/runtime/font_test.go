@@ -0,0 +1,137 @@
+package runtime
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// golden compares got with the golden file testdata/name, or rewrites the
+// file if the -update flag is set.
+func golden(t *testing.T, name string, got []byte) {
+	t.Helper()
+
+	if *update {
+		err := os.WriteFile(filepath.Join("testdata", name), got, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	compareGolden(t, name, got, "run the tests with -update if the change is intended")
+}
+
+// compareGolden compares got with the file testdata/name and reports a
+// difference with hint.
+func compareGolden(t *testing.T, name string, got []byte, hint string) {
+	t.Helper()
+
+	path := filepath.Join("testdata", name)
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs, %s", path, hint)
+	}
+}
+
+func TestFontGlyphs(t *testing.T) {
+	vpu := newTestVPU(t)
+	setDrawColors(vpu, 0x04)
+
+	var out bytes.Buffer
+	for c := fontFirst; c <= 0xff; c++ {
+		vpu.Clear()
+		vpu.Text([]byte{byte(c)}, 0, 0)
+
+		fmt.Fprintf(&out, "0x%02x\n%s", c, dump(vpu, 0, 0, 8, 8))
+	}
+
+	golden(t, "font.golden", out.Bytes())
+}
+
+func TestFontButtonGlyphs(t *testing.T) {
+	vpu := newTestVPU(t)
+	setDrawColors(vpu, 0x04)
+
+	for _, c := range []byte{0x80, 0x81, 0x84, 0x85, 0x86, 0x87} {
+		vpu.Clear()
+		vpu.Text([]byte{c}, 0, 0)
+
+		if !strings.Contains(dump(vpu, 0, 0, 8, 8), "#") {
+			t.Errorf("glyph 0x%02x is empty", c)
+		}
+	}
+}
+
+func TestTextControlCharacters(t *testing.T) {
+	vpu := newTestVPU(t)
+	setDrawColors(vpu, 0x04)
+
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"newline", "A\nB", "A \nB "},
+		{"newline keeps column", "AB\nC", "AB\nC "},
+		{"control characters leave a cell", "A\x01B", "A B"},
+		{"null ends the text", "A\x00B", "A  "},
+		{"tab leaves a cell", "\tA", " A"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows := strings.Split(tt.want, "\n")
+
+			vpu.Clear()
+			for row, line := range rows {
+				for col, c := range []byte(line) {
+					if c != ' ' {
+						vpu.Text([]byte{c}, int32(col*8), int32(row*8))
+					}
+				}
+			}
+			want := dump(vpu, 0, 0, len(rows[0])*8, len(rows)*8)
+
+			vpu.Clear()
+			vpu.Text([]byte(tt.text), 0, 0)
+			got := dump(vpu, 0, 0, len(rows[0])*8, len(rows)*8)
+
+			if got != want {
+				t.Errorf("got\n%swant\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestTextNullTerminated(t *testing.T) {
+	vpu := newTestVPU(t)
+	setDrawColors(vpu, 0x04)
+
+	vpu.Text([]byte("Hi\x00there"), 0, 0)
+
+	golden(t, "text_null.golden", []byte(dump(vpu, 0, 0, 48, 8)))
+}
+
+func TestTextClipping(t *testing.T) {
+	vpu := newTestVPU(t)
+	setDrawColors(vpu, 0x04)
+
+	// Must neither panic nor wrap around
+	vpu.Text([]byte("clipped"), -20, -4)
+	vpu.Text([]byte("clipped"), WIDTH-12, HEIGHT-4)
+
+	if strings.Contains(dump(vpu, 0, 8, WIDTH, HEIGHT-16), "#") {
+		t.Error("text drawn outside of its rows")
+	}
+}
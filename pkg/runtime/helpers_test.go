@@ -0,0 +1,51 @@
+package runtime
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// readTestCart reads testdata/carts/name.wasm. What each cart does is
+// described at the top of its .wat file.
+func readTestCart(t *testing.T, name string) []byte {
+	t.Helper()
+
+	code, err := os.ReadFile(filepath.Join("testdata", "carts", name+".wasm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return code
+}
+
+// loadTestCart runs testdata/carts/name.wasm with disk as its storage.
+func loadTestCart(t *testing.T, name string, disk []byte) *Runtime {
+	t.Helper()
+
+	rt, err := NewRuntime()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { rt.Close() })
+
+	rt.Storage = NewMemoryStorage(disk)
+	err = rt.LoadCart(readTestCart(t, name), name+".wasm")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rt
+}
+
+// stepFrames runs n frames without input.
+func stepFrames(t *testing.T, rt *Runtime, n int) {
+	t.Helper()
+
+	for i := 0; i < n; i++ {
+		err := rt.Step(InputState{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
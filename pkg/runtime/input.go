@@ -0,0 +1,42 @@
+package runtime
+
+import (
+	"encoding/binary"
+
+	"github.com/tetratelabs/wazero/api"
+)
+
+const (
+	PadIdle  byte = 0
+	PadX     byte = 1
+	PadY     byte = 1 << 1
+	PadLeft  byte = 1 << 4
+	PadRight byte = 1 << 5
+	PadUp    byte = 1 << 6
+	PadDown  byte = 1 << 7
+)
+
+const (
+	MouseLeft   byte = 1
+	MouseRight  byte = 2
+	MouseMiddle byte = 4
+)
+
+// InputState is everything a cart can read from its players during a
+// single frame.
+type InputState struct {
+	Gamepads     [4]byte
+	MouseX       int16
+	MouseY       int16
+	MouseButtons byte
+}
+
+func (input InputState) write(mem api.Memory) {
+	mem.Write(MemGamepads, input.Gamepads[:])
+
+	mouse := make([]byte, SizeMouseX+SizeMouseY+SizeMouseButtons)
+	binary.LittleEndian.PutUint16(mouse[0:], uint16(input.MouseX))
+	binary.LittleEndian.PutUint16(mouse[2:], uint16(input.MouseY))
+	mouse[4] = input.MouseButtons
+	mem.Write(MemMouseX, mouse)
+}
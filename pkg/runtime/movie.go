@@ -0,0 +1,137 @@
+package runtime
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var movieMagic = [4]byte{'W', '4', 'M', 1}
+
+// frameSize is the size of a single recorded InputState.
+const frameSize = 4 + SizeMouseX + SizeMouseY + SizeMouseButtons
+
+// Movie is a recording of the input of every frame, starting with the first
+// update after the cart was loaded. Running the same cart with the same disk
+// and this input reproduces the session bit by bit.
+type Movie struct {
+	Cart   [sha256.Size]byte
+	Disk   []byte
+	Frames []InputState
+}
+
+// NewMovie starts a recording for the loaded cart. It remembers the disk
+// contents the cart found when it was loaded.
+func (rt *Runtime) NewMovie() *Movie {
+	return &Movie{
+		Cart: rt.cartHash,
+		Disk: append([]byte{}, rt.initialDisk...),
+	}
+}
+
+// Check fails with ErrWrongCart if the movie was recorded with a different
+// cart than the one rt runs.
+func (m *Movie) Check(rt *Runtime) error {
+	if m.Cart != rt.cartHash {
+		return ErrWrongCart
+	}
+
+	return nil
+}
+
+// Save writes the movie in its compressed binary format: a magic number, the
+// cart hash, the disk and a fixed size record per frame.
+func (m *Movie) Save(w io.Writer) error {
+	zw := gzip.NewWriter(w)
+	bw := bufio.NewWriter(zw)
+
+	bw.Write(movieMagic[:])
+	bw.Write(m.Cart[:])
+	binary.Write(bw, binary.LittleEndian, uint32(len(m.Disk)))
+	bw.Write(m.Disk)
+	binary.Write(bw, binary.LittleEndian, uint32(len(m.Frames)))
+
+	var frame [frameSize]byte
+	for _, input := range m.Frames {
+		copy(frame[:], input.Gamepads[:])
+		binary.LittleEndian.PutUint16(frame[4:], uint16(input.MouseX))
+		binary.LittleEndian.PutUint16(frame[6:], uint16(input.MouseY))
+		frame[8] = input.MouseButtons
+		bw.Write(frame[:])
+	}
+
+	err := bw.Flush()
+	if err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+// ReadMovie reads a movie written by Save.
+func ReadMovie(r io.Reader) (*Movie, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	br := bufio.NewReader(zr)
+
+	var magic [4]byte
+	_, err = io.ReadFull(br, magic[:])
+	if err != nil {
+		return nil, err
+	}
+	if magic != movieMagic {
+		return nil, errors.New("not a w4g movie")
+	}
+
+	m := &Movie{}
+	_, err = io.ReadFull(br, m.Cart[:])
+	if err != nil {
+		return nil, err
+	}
+
+	var size uint32
+	err = binary.Read(br, binary.LittleEndian, &size)
+	if err != nil {
+		return nil, err
+	}
+	if size > 1024 {
+		return nil, fmt.Errorf("disk of %d bytes is too large", size)
+	}
+
+	m.Disk = make([]byte, size)
+	_, err = io.ReadFull(br, m.Disk)
+	if err != nil {
+		return nil, err
+	}
+
+	var frames uint32
+	err = binary.Read(br, binary.LittleEndian, &frames)
+	if err != nil {
+		return nil, err
+	}
+
+	var frame [frameSize]byte
+	for i := uint32(0); i < frames; i++ {
+		_, err = io.ReadFull(br, frame[:])
+		if err != nil {
+			return nil, err
+		}
+
+		var input InputState
+		copy(input.Gamepads[:], frame[:4])
+		input.MouseX = int16(binary.LittleEndian.Uint16(frame[4:]))
+		input.MouseY = int16(binary.LittleEndian.Uint16(frame[6:]))
+		input.MouseButtons = frame[8]
+		m.Frames = append(m.Frames, input)
+	}
+
+	return m, nil
+}
@@ -0,0 +1,143 @@
+package runtime
+
+import (
+	"bytes"
+	"compress/gzip"
+	"testing"
+)
+
+// gzipped compresses data like a movie file.
+func gzipped(data []byte) []byte {
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	zw.Write(data)
+	zw.Close()
+
+	return b.Bytes()
+}
+
+func TestMovieReplay(t *testing.T) {
+	rt := loadTestCart(t, "input", []byte{0x5a})
+	movie := rt.NewMovie()
+
+	var framebuffers [][]byte
+	for i := 0; i < 40; i++ {
+		input := InputState{
+			Gamepads:     [4]byte{byte(i), 0, byte(i * 3), 0xff},
+			MouseX:       int16(i*7 - 100),
+			MouseY:       int16(-i),
+			MouseButtons: byte(i % 8),
+		}
+		movie.Frames = append(movie.Frames, input)
+
+		err := rt.Step(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		framebuffers = append(framebuffers, append([]byte{}, rt.Framebuffer()...))
+	}
+
+	var saved bytes.Buffer
+	err := movie.Save(&saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replay, err := ReadMovie(&saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replay.Cart != movie.Cart || !bytes.Equal(replay.Disk, []byte{0x5a}) || len(replay.Frames) != len(movie.Frames) {
+		t.Fatalf("read back a different movie")
+	}
+
+	rt = loadTestCart(t, "input", replay.Disk)
+	err = replay.Check(rt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, input := range replay.Frames {
+		if input != movie.Frames[i] {
+			t.Fatalf("input of frame %d is %+v, want %+v", i, input, movie.Frames[i])
+		}
+
+		err := rt.Step(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(rt.Framebuffer(), framebuffers[i]) {
+			t.Fatalf("framebuffer of frame %d differs", i)
+		}
+	}
+}
+
+func TestReadMovieErrors(t *testing.T) {
+	rt := loadTestCart(t, "input", []byte("disk"))
+	movie := rt.NewMovie()
+	movie.Frames = make([]InputState, 3)
+
+	var saved bytes.Buffer
+	err := movie.Save(&saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := gzip.NewReader(&saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw bytes.Buffer
+	raw.ReadFrom(zr)
+	data := raw.Bytes()
+
+	badMagic := append([]byte{}, data...)
+	badMagic[0] = 'X'
+
+	tooLarge := append([]byte{}, data...)
+	tooLarge[4+32+1] = 0x10
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"not gzipped", data},
+		{"empty", gzipped(nil)},
+		{"bad magic", gzipped(badMagic)},
+		{"old version", gzipped(append([]byte{'W', '4', 'M', 0}, data[4:]...))},
+		{"truncated hash", gzipped(data[:4+16])},
+		{"disk too large", gzipped(tooLarge)},
+		{"truncated disk", gzipped(data[:4+32+4+2])},
+		{"no frame count", gzipped(data[:4+32+4+4])},
+		{"truncated frame", gzipped(data[:len(data)-1])},
+		{"missing frame", gzipped(data[:len(data)-int(frameSize)])},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ReadMovie(bytes.NewReader(test.data))
+			if err == nil {
+				t.Error("no error")
+			}
+		})
+	}
+
+	if _, err := ReadMovie(bytes.NewReader(gzipped(data))); err != nil {
+		t.Errorf("the unmodified movie fails with %v", err)
+	}
+}
+
+func TestMovieCheck(t *testing.T) {
+	rt := loadTestCart(t, "input", nil)
+	movie := rt.NewMovie()
+
+	err := movie.Check(rt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other := loadTestCart(t, "counter", nil)
+	if err := movie.Check(other); err != ErrWrongCart {
+		t.Errorf("got %v, want ErrWrongCart", err)
+	}
+}
@@ -2,16 +2,41 @@ package runtime
 
 import (
 	"context"
-	"log"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/tetratelabs/wazero/api"
 )
 
+var defaultSink = NewStderrSink()
+
+// emit passes a message of the cart to the TraceSink.
+func (rt *Runtime) emit(source, message string) {
+	sink := rt.TraceSink
+	if sink == nil {
+		sink = defaultSink
+	}
+
+	entry := TraceEntry{
+		Time:    time.Now(),
+		Frame:   rt.frame,
+		Source:  source,
+		Message: message,
+	}
+
+	sink.Trace(entry)
+	if rt.recentTrace != nil {
+		rt.recentTrace.Trace(entry)
+	}
+}
+
 // trace prints a message to the debug console from a *zero-terminated*
 // string pointer.
 func (rt *Runtime) trace(_ context.Context, mod api.Module, params []uint64) {
 	str := int32(params[0])
-	/* message */ _ = getString(mod.Memory(), str)
+
+	rt.emit("trace", string(getString(mod.Memory(), "trace", "str", str)))
 }
 
 // traceUtf8 prints a message to the debug console from a UTF-8 encoded
@@ -20,10 +45,10 @@ func (rt *Runtime) traceUtf8(_ context.Context, mod api.Module, params []uint64)
 	str := int32(params[0])
 	byteLength := int32(params[1])
 
-	/* message */
-	if message, ok := mod.Memory().Read(uint32(str), uint32(byteLength)); ok {
-		log.Printf("%s", message)
-	}
+	checkLength("traceUtf8", "byteLength", byteLength)
+	message := readMemory(mod.Memory(), "traceUtf8", "str", str, uint32(byteLength))
+
+	rt.emit("traceUtf8", strings.ToValidUTF8(string(message), "\uFFFD"))
 }
 
 // traceUtf16 prints a message to the debug console from a UTF-16 encoded
@@ -32,10 +57,10 @@ func (rt *Runtime) traceUtf16(_ context.Context, mod api.Module, params []uint64
 	str := int32(params[0])
 	byteLength := int32(params[1])
 
-	/* message */
-	if message, ok := mod.Memory().Read(uint32(str), uint32(byteLength)); ok {
-		log.Printf("%s", message)
-	}
+	checkLength("traceUtf16", "byteLength", byteLength)
+	message := readMemory(mod.Memory(), "traceUtf16", "str", str, uint32(byteLength))
+
+	rt.emit("traceUtf16", string(decodeUtf16(message)))
 }
 
 // tracef prints a message to the debug console from the following input:
@@ -44,6 +69,83 @@ func (rt *Runtime) traceUtf16(_ context.Context, mod api.Module, params []uint64
 // * %f expects 64-bit floats.
 // * %s expects a *zero-terminated* string pointer.
 func (rt *Runtime) tracef(_ context.Context, mod api.Module, params []uint64) {
-	/* str := */ _ = int32(params[0])
-	/* stack := */ _ = int32(params[1])
+	str := int32(params[0])
+	stack := int32(params[1])
+
+	rt.emit("tracef", formatTrace(mod.Memory(), str, stack))
+}
+
+// formatTrace formats the zero-terminated string at str, reading the values
+// from the argument stack the way C and Zig lay out varargs: every argument
+// is aligned to its own size. It traps if the string or an argument is
+// outside of the memory.
+func formatTrace(mem api.Memory, str, stack int32) string {
+	var (
+		format = getString(mem, "tracef", "str", str)
+		args   = uint32(stack)
+		output strings.Builder
+	)
+
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 == len(format) {
+			output.WriteByte(format[i])
+			continue
+		}
+
+		i++
+		switch format[i] {
+		case 'c':
+			v := readArg32(mem, args)
+			output.WriteRune(rune(int32(v)))
+			args += 4
+
+		case 'd':
+			v := readArg32(mem, args)
+			output.WriteString(strconv.FormatInt(int64(int32(v)), 10))
+			args += 4
+
+		case 'x':
+			v := readArg32(mem, args)
+			output.WriteString(strconv.FormatUint(uint64(v), 16))
+			args += 4
+
+		case 's':
+			v := readArg32(mem, args)
+			output.Write(getString(mem, "tracef", "stack", int32(v)))
+			args += 4
+
+		case 'f':
+			args = (args + 7) &^ 7
+			v := readArgFloat64(mem, args)
+			output.WriteString(strconv.FormatFloat(v, 'g', -1, 64))
+			args += 8
+
+		case '%':
+			output.WriteByte('%')
+
+		default:
+			output.WriteByte('%')
+			output.WriteByte(format[i])
+		}
+	}
+
+	return output.String()
+}
+
+func readArg32(mem api.Memory, args uint32) uint32 {
+	v, ok := mem.ReadUint32Le(args)
+	if !ok {
+		trap("tracef", "stack", "argument at %#x is outside of the memory", args)
+	}
+
+	return v
+}
+
+func readArgFloat64(mem api.Memory, args uint32) float64 {
+	v, ok := mem.ReadFloat64Le(args)
+	if !ok {
+		trap("tracef", "stack", "argument at %#x is outside of the memory", args)
+	}
+
+	return v
 }
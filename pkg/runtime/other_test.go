@@ -0,0 +1,127 @@
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// varargs lays out the arguments of a tracef call, each uint32 taking 4
+// bytes and each float64 8. Padding has to be given explicitly.
+func varargs(values ...interface{}) []byte {
+	var b bytes.Buffer
+	for _, v := range values {
+		switch v := v.(type) {
+		case uint32:
+			binary.Write(&b, binary.LittleEndian, v)
+		case int32:
+			binary.Write(&b, binary.LittleEndian, v)
+		case float64:
+			binary.Write(&b, binary.LittleEndian, math.Float64bits(v))
+		}
+	}
+
+	return b.Bytes()
+}
+
+func TestFormatTrace(t *testing.T) {
+	const (
+		format = 0x2000
+		stack  = 0x3000
+		str    = 0x4000
+	)
+
+	tests := []struct {
+		name   string
+		format string
+		args   []byte
+		want   string
+	}{
+		{"plain", "hello", nil, "hello"},
+		{"percent", "100%%", nil, "100%"},
+		{"trailing percent", "100%", nil, "100%"},
+		{"char", "%c%c", varargs(uint32('o'), uint32('k')), "ok"},
+		{"char beyond ascii", "%c", varargs(uint32('é')), "é"},
+		{"decimal", "%d %d", varargs(int32(42), int32(-7)), "42 -7"},
+		{"hex", "%x", varargs(uint32(0xdeadbeef)), "deadbeef"},
+		{"hex negative", "%x", varargs(int32(-1)), "ffffffff"},
+		{"string", "<%s>", varargs(uint32(str)), "<WASM-4>"},
+		{"float", "%f", varargs(1.5), "1.5"},
+		{"float negative", "%f", varargs(-0.25), "-0.25"},
+		{"float aligned", "%d %f", varargs(int32(1), uint32(0xffffffff), 2.5), "1 2.5"},
+		{"after float", "%f %d", varargs(2.5, int32(3)), "2.5 3"},
+		{"mixed", "%s: %d/%x %c %f", varargs(uint32(str), int32(10), uint32(255), uint32('!'), 0.5), "WASM-4: 10/ff ! 0.5"},
+		{"unknown verb", "%q %d", varargs(int32(1)), "%q 1"},
+		{"unknown verb takes no argument", "%u%d", varargs(int32(5)), "%u5"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, mod := newTestRuntime(t)
+			mem := mod.Memory()
+			mem.Write(format, append([]byte(test.format), 0))
+			mem.Write(stack, test.args)
+			mem.Write(str, []byte("WASM-4\x00"))
+
+			var got string
+			if trap := call(func() { got = formatTrace(mem, format, stack) }); trap != nil {
+				t.Fatal(trap)
+			}
+			if got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFormatTraceTraps(t *testing.T) {
+	const end = 0x10000
+
+	tests := []struct {
+		name   string
+		format string
+		stack  int32
+		args   []byte
+	}{
+		{"string outside", "%s", 0x3000, varargs(uint32(end))},
+		{"string negative", "%s", 0x3000, varargs(int32(-1))},
+		{"string unterminated", "%s", 0x3000, varargs(uint32(end - 1))},
+		{"stack at the end", "%d", end - 2, nil},
+		{"float at the end", "%f", end - 8 + 1, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, mod := newTestRuntime(t)
+			mem := mod.Memory()
+			mem.Write(0x2000, append([]byte(test.format), 0))
+			mem.Write(uint32(test.stack), test.args)
+			mem.WriteByte(end-1, 'A')
+
+			trap := call(func() { formatTrace(mem, 0x2000, test.stack) })
+			if trap == nil {
+				t.Fatal("no trap")
+			}
+			if trap.Function != "tracef" || trap.Argument != "stack" {
+				t.Errorf("trapped in %s with %s, want tracef with stack", trap.Function, trap.Argument)
+			}
+		})
+	}
+}
+
+func TestTracef(t *testing.T) {
+	rt, mod := newTestRuntime(t)
+
+	var entries []TraceEntry
+	rt.TraceSink = TraceFunc(func(entry TraceEntry) { entries = append(entries, entry) })
+
+	mod.Memory().Write(0x2000, []byte("%d lives\x00"))
+	mod.Memory().Write(0x3000, varargs(int32(3)))
+	rt.tracef(context.TODO(), mod, []uint64{0x2000, 0x3000})
+
+	if len(entries) != 1 || entries[0].Source != "tracef" || entries[0].Message != "3 lives" {
+		t.Errorf("traced %+v", entries)
+	}
+}
@@ -0,0 +1,44 @@
+package runtime
+
+import (
+	"image/color"
+)
+
+// PixelConverter turns the 2bpp framebuffer into RGBA pixels.
+//
+// It keeps a table with the four pixels of every possible framebuffer byte,
+// so a frame is converted with a single copy per byte. The table is only
+// rebuilt when the palette changes.
+type PixelConverter struct {
+	palette [4]color.RGBA
+	table   [256][16]byte
+	valid   bool
+}
+
+// Convert writes the pixels of framebuffer to dst, which must hold
+// WIDTH*HEIGHT*4 bytes.
+func (c *PixelConverter) Convert(dst []byte, framebuffer []byte, palette [4]color.RGBA) {
+	if !c.valid || c.palette != palette {
+		c.build(palette)
+	}
+
+	dst = dst[:len(framebuffer)*16]
+	for i, pixels := range framebuffer {
+		copy(dst[i*16:i*16+16], c.table[pixels][:])
+	}
+}
+
+func (c *PixelConverter) build(palette [4]color.RGBA) {
+	for pixels := range c.table {
+		for x := 0; x < 4; x++ {
+			rgba := palette[(pixels>>(x*2))&0x3]
+			c.table[pixels][x*4+0] = rgba.R
+			c.table[pixels][x*4+1] = rgba.G
+			c.table[pixels][x*4+2] = rgba.B
+			c.table[pixels][x*4+3] = rgba.A
+		}
+	}
+
+	c.palette = palette
+	c.valid = true
+}
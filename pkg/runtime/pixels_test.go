@@ -0,0 +1,54 @@
+package runtime
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestPixelConverter(t *testing.T) {
+	palette := [4]color.RGBA{
+		{R: 0x10, G: 0x11, B: 0x12, A: 0xff},
+		{R: 0x20, G: 0x21, B: 0x22, A: 0xff},
+		{R: 0x30, G: 0x31, B: 0x32, A: 0xff},
+		{R: 0x40, G: 0x41, B: 0x42, A: 0xff},
+	}
+
+	framebuffer := make([]byte, SizeFramebuffer)
+	for i := range framebuffer {
+		framebuffer[i] = byte(i * 7)
+	}
+
+	var converter PixelConverter
+	pixels := make([]byte, WIDTH*HEIGHT*4)
+
+	check := func() {
+		t.Helper()
+
+		for pixel := 0; pixel < WIDTH*HEIGHT; pixel++ {
+			want := palette[(framebuffer[pixel/4]>>((pixel%4)*2))&0x3]
+			got := color.RGBA{pixels[pixel*4], pixels[pixel*4+1], pixels[pixel*4+2], pixels[pixel*4+3]}
+			if got != want {
+				t.Fatalf("pixel %d is %v, want %v", pixel, got, want)
+			}
+		}
+	}
+
+	converter.Convert(pixels, framebuffer, palette)
+	check()
+
+	// A new palette must not reuse the old table
+	palette[2] = color.RGBA{R: 0xaa, G: 0xbb, B: 0xcc, A: 0xff}
+	converter.Convert(pixels, framebuffer, palette)
+	check()
+}
+
+func BenchmarkPixelConverter(b *testing.B) {
+	var converter PixelConverter
+	framebuffer := make([]byte, SizeFramebuffer)
+	pixels := make([]byte, WIDTH*HEIGHT*4)
+	palette := [4]color.RGBA{{A: 0xff}, {R: 0xff, A: 0xff}, {G: 0xff, A: 0xff}, {B: 0xff, A: 0xff}}
+
+	for i := 0; i < b.N; i++ {
+		converter.Convert(pixels, framebuffer, palette)
+	}
+}
@@ -0,0 +1,130 @@
+package runtime
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"log"
+)
+
+// ReloadMode decides what a reloaded cart takes over from the build it
+// replaces.
+type ReloadMode int
+
+const (
+	// ReloadRestart starts the new build from scratch, like LoadCart.
+	ReloadRestart ReloadMode = iota
+
+	// ReloadMemory carries over the memory, so the new build continues with
+	// the variables of the old one. The registers below MemUser are taken
+	// over as well, so a palette set in start survives. Globals, like the
+	// stack pointer, start fresh and start isn't run. As the data of the new
+	// build is overwritten too, changed constants like sprites only show up
+	// after a restart.
+	ReloadMemory
+
+	// ReloadState carries over a complete snapshot of the old build: the
+	// memory, the globals and the sound. If the new build has different
+	// globals, only the memory is carried over.
+	ReloadState
+)
+
+var reloadModes = []string{"restart", "memory", "state"}
+
+func (m ReloadMode) String() string {
+	if m < 0 || int(m) >= len(reloadModes) {
+		return fmt.Sprintf("ReloadMode(%d)", int(m))
+	}
+
+	return reloadModes[m]
+}
+
+// ParseReloadMode parses the name of a mode: restart, memory or state.
+func ParseReloadMode(name string) (ReloadMode, error) {
+	for i, mode := range reloadModes {
+		if mode == name {
+			return ReloadMode(i), nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown reload mode %q, use restart, memory or state", name)
+}
+
+// Reload replaces the running cart with a new build of it. If the new build
+// doesn't validate or instantiate, the old one keeps running untouched and
+// the error is returned. Once the new build replaced the old one, the only
+// error is a *Crash of the new build in start, kept like in LoadCart. A crash
+// or pause of the old build is cleared.
+//
+// The storage is kept. Snapshots of the old build, like those of a Rewind,
+// don't fit the new one.
+func (rt *Runtime) Reload(code []byte, mode ReloadMode) error {
+	diags := Validate(code)
+	if diags.Failed() {
+		return diags
+	}
+	for _, diag := range diags {
+		log.Printf("%s: %s", rt.cartName, diag)
+	}
+
+	hash := sha256.Sum256(code)
+	functions := functionNames(code)
+	code, globals := exportGlobals(code)
+
+	compiled, err := rt.runtime.CompileModule(rt.ctx, code)
+	if err != nil {
+		return diags.wrap(err)
+	}
+
+	// The memory is imported from env and shared by both builds. The new
+	// build writes its data into it while being instantiated.
+	state := rt.snapshot(nil, false)
+	if mode == ReloadRestart {
+		rt.cart.Memory().Write(0, make([]byte, len(state.Memory)))
+	}
+
+	cart, err := instantiate(rt.ctx, rt.runtime, compiled)
+	if err != nil {
+		rt.cart.Memory().Write(0, state.Memory)
+		compiled.Close(rt.ctx)
+		return diags.wrap(err)
+	}
+
+	rt.cart.Close(rt.ctx)
+	rt.compiled.Close(rt.ctx)
+
+	rt.cart = cart
+	rt.compiled = compiled
+	rt.cartHash = hash
+	rt.functions = functions
+	rt.globals = globals
+	rt.VPU = NewVPU(cart.Memory())
+	rt.crash = nil
+	rt.paused = nil
+	rt.before = nil
+
+	if mode == ReloadState && len(state.Globals) != len(rt.globals) {
+		log.Printf("%s: globals changed, only the memory is carried over", rt.cartName)
+		mode = ReloadMemory
+	}
+
+	switch mode {
+	case ReloadMemory:
+		cart.Memory().Write(0, state.Memory)
+		return nil
+
+	case ReloadState:
+		err = rt.restore(state, false)
+		if err != nil {
+			// Fall back to the memory alone
+			log.Printf("%s: %v, only the memory is carried over", rt.cartName, err)
+			cart.Memory().Write(0, state.Memory)
+		}
+		return nil
+
+	default:
+		rt.frame = 0
+		rt.forgetInputs(0)
+		rt.APU = NewAPU()
+		return rt.start()
+	}
+}
@@ -0,0 +1,85 @@
+package runtime
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestReload(t *testing.T) {
+	code := readTestCart(t, "counter")
+
+	tests := []struct {
+		mode    ReloadMode
+		frame   uint64
+		memory  uint32
+		globals uint64
+	}{
+		{ReloadRestart, 0, 0, 0},
+		{ReloadMemory, 3, 3, 0},
+		{ReloadState, 3, 3, 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.mode.String(), func(t *testing.T) {
+			rt := loadTestCart(t, "counter", nil)
+			stepFrames(t, rt, 3)
+
+			err := rt.Reload(code, test.mode)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			state := rt.Snapshot(nil)
+			memory, _ := rt.Memory().ReadUint32Le(MemUser)
+			if state.Frame != test.frame || memory != test.memory || state.Globals[0] != test.globals {
+				t.Errorf("got frame %d, memory %d, global %d, want %d, %d, %d",
+					state.Frame, memory, state.Globals[0], test.frame, test.memory, test.globals)
+			}
+
+			stepFrames(t, rt, 1)
+		})
+	}
+}
+
+func TestReloadInvalid(t *testing.T) {
+	rt := loadTestCart(t, "counter", nil)
+
+	err := rt.Reload(readTestCart(t, "invalid"), ReloadState)
+	var diags Diagnostics
+	if !errors.As(err, &diags) {
+		t.Fatalf("got %v, want diagnostics", err)
+	}
+
+	// The old build keeps running
+	stepFrames(t, rt, 1)
+
+	memory, _ := rt.Memory().ReadUint32Le(MemUser)
+	if memory != 1 {
+		t.Errorf("got memory %d after a frame, want 1", memory)
+	}
+}
+
+func TestReloadCrashInStart(t *testing.T) {
+	rt := loadTestCart(t, "counter", nil)
+	trapping := readTestCart(t, "trapstart")
+
+	// The new build replaced the old one before it crashed
+	err := rt.Reload(trapping, ReloadRestart)
+	var crash *Crash
+	if !errors.As(err, &crash) {
+		t.Fatalf("got %v, want a crash", err)
+	}
+	if rt.Crash() != crash || rt.Step(InputState{}) != crash {
+		t.Errorf("crash of the new build not kept")
+	}
+
+	// start isn't run when carrying over state
+	err = rt.Reload(trapping, ReloadState)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rt.Crash() != nil {
+		t.Errorf("crash kept after reload: %v", rt.Crash())
+	}
+	stepFrames(t, rt, 1)
+}
@@ -0,0 +1,159 @@
+package runtime
+
+import (
+	"encoding/binary"
+)
+
+// Rewind remembers the last frames of a cart, so they can be played backwards.
+//
+// Only the newest frame is kept as a full copy of the memory. Every older
+// frame is stored as the XOR against its successor, run-length encoded. Most
+// of the memory stays the same between two frames, so a frame usually costs
+// little more than the part of the framebuffer that changed. The disk is left
+// alone: rewinding never undoes a save.
+type Rewind struct {
+	rt *Runtime
+
+	// Ring buffer of the older frames, entries[head] is the newest one.
+	entries []rewindEntry
+	head    int
+	count   int
+
+	last    *State
+	current *State
+}
+
+type rewindEntry struct {
+	frame   uint64
+	delta   []byte
+	globals []uint64
+	apu     []byte
+}
+
+// NewRewind creates a rewind buffer holding up to frames frames of rt.
+func NewRewind(rt *Runtime, frames int) *Rewind {
+	return &Rewind{
+		rt:      rt,
+		entries: make([]rewindEntry, frames),
+		head:    -1,
+	}
+}
+
+// Len returns the number of frames that can be rewound.
+func (r *Rewind) Len() int {
+	return r.count
+}
+
+// Reset forgets all frames.
+func (r *Rewind) Reset() {
+	r.head = -1
+	r.count = 0
+	r.last = nil
+}
+
+// Push records the current frame of the cart. Call it after every Step.
+func (r *Rewind) Push() {
+	if len(r.entries) == 0 {
+		return
+	}
+
+	r.current = r.rt.snapshot(r.current, false)
+	if r.last == nil || len(r.last.Memory) != len(r.current.Memory) {
+		r.Reset()
+		r.last, r.current = r.current, r.last
+		return
+	}
+
+	r.head = (r.head + 1) % len(r.entries)
+	if r.count < len(r.entries) {
+		r.count++
+	}
+
+	entry := &r.entries[r.head]
+	entry.frame = r.last.Frame
+	entry.delta = appendDelta(entry.delta[:0], r.last.Memory, r.current.Memory)
+	entry.globals = append(entry.globals[:0], r.last.Globals...)
+	entry.apu = append(entry.apu[:0], r.last.APU...)
+
+	r.last, r.current = r.current, r.last
+}
+
+// Step restores the previous frame and drops it from the buffer. It returns
+// false once there is nothing left to rewind.
+func (r *Rewind) Step() (bool, error) {
+	if r.count == 0 {
+		return false, nil
+	}
+
+	entry := &r.entries[r.head]
+	applyDelta(r.last.Memory, entry.delta)
+	r.last.Frame = entry.frame
+	r.last.Globals = append(r.last.Globals[:0], entry.globals...)
+	r.last.APU = append(r.last.APU[:0], entry.apu...)
+
+	r.head = (r.head - 1 + len(r.entries)) % len(r.entries)
+	r.count--
+
+	return true, r.rt.restore(r.last, false)
+}
+
+// appendDelta appends the XOR of a and b to dst. The delta is a sequence of
+// runs, each one the number of unchanged bytes followed by the number of
+// changed bytes and their XOR. a and b must have the same length.
+func appendDelta(dst []byte, a, b []byte) []byte {
+	// Short gaps are cheaper to store as part of the changed bytes than to
+	// start a new run.
+	const minGap = 4
+
+	var tmp [binary.MaxVarintLen64]byte
+
+	pos := 0
+	for pos < len(a) {
+		start := pos
+		for pos < len(a) && a[pos] == b[pos] {
+			pos++
+		}
+		if pos == len(a) {
+			break
+		}
+		skip := pos - start
+
+		start = pos
+		gap := 0
+		for pos < len(a) && gap < minGap {
+			if a[pos] == b[pos] {
+				gap++
+			} else {
+				gap = 0
+			}
+			pos++
+		}
+		pos -= gap
+
+		dst = append(dst, tmp[:binary.PutUvarint(tmp[:], uint64(skip))]...)
+		dst = append(dst, tmp[:binary.PutUvarint(tmp[:], uint64(pos-start))]...)
+		for i := start; i < pos; i++ {
+			dst = append(dst, a[i]^b[i])
+		}
+	}
+
+	return dst
+}
+
+// applyDelta XORs a delta created by appendDelta into mem.
+func applyDelta(mem []byte, delta []byte) {
+	pos := 0
+	for len(delta) > 0 {
+		skip, n := binary.Uvarint(delta)
+		delta = delta[n:]
+		length, n := binary.Uvarint(delta)
+		delta = delta[n:]
+
+		pos += int(skip)
+		for i := 0; i < int(length); i++ {
+			mem[pos+i] ^= delta[i]
+		}
+		pos += int(length)
+		delta = delta[length:]
+	}
+}
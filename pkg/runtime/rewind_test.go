@@ -0,0 +1,102 @@
+package runtime
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestDelta(t *testing.T) {
+	const size = 1024
+
+	changed := func(ranges ...[2]int) []byte {
+		b := make([]byte, size)
+		for _, r := range ranges {
+			for i := r[0]; i < r[1]; i++ {
+				b[i] = byte(i) | 1
+			}
+		}
+		return b
+	}
+
+	tests := []struct {
+		name string
+		b    []byte
+		want int
+	}{
+		{"identical", changed(), 0},
+		{"fully changed", changed([2]int{0, size}), 1 + 2 + size},
+		{"first byte", changed([2]int{0, 1}), 1 + 1 + 1},
+		{"last byte", changed([2]int{size - 1, size}), 2 + 1 + 1},
+		{"long runs", changed([2]int{300, 500}), 2 + 2 + 200},
+		{"short gap", changed([2]int{10, 12}, [2]int{14, 16}), 1 + 1 + 6},
+		{"long gap", changed([2]int{10, 12}, [2]int{20, 22}), 2 * (1 + 1 + 2)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := make([]byte, size)
+
+			delta := appendDelta(nil, a, test.b)
+			if len(delta) != test.want {
+				t.Errorf("delta has %d bytes, want %d", len(delta), test.want)
+			}
+
+			applyDelta(a, delta)
+			if !bytes.Equal(a, test.b) {
+				t.Error("applying the delta doesn't give the new frame")
+			}
+
+			// XOR works both ways
+			applyDelta(a, delta)
+			if !bytes.Equal(a, make([]byte, size)) {
+				t.Error("applying the delta twice doesn't give the old frame")
+			}
+		})
+	}
+}
+
+func TestDeltaAppends(t *testing.T) {
+	a := []byte{1, 2, 3}
+	b := []byte{1, 5, 3}
+
+	delta := appendDelta([]byte{0xff}, a, b)
+	if !bytes.Equal(delta, []byte{0xff, 1, 1, 2 ^ 5}) {
+		t.Errorf("got %v", delta)
+	}
+}
+
+func TestRewindEviction(t *testing.T) {
+	rt := loadTestCart(t, "counter", nil)
+	rewind := NewRewind(rt, 3)
+
+	rewind.Push()
+	for i := 0; i < 5; i++ {
+		err := rt.Step(InputState{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rewind.Push()
+	}
+
+	if rewind.Len() != 3 {
+		t.Fatalf("holds %d frames, want 3", rewind.Len())
+	}
+
+	for want := uint64(4); want >= 2; want-- {
+		ok, err := rewind.Step()
+		if !ok || err != nil {
+			t.Fatalf("rewinding to frame %d: %t, %v", want, ok, err)
+		}
+
+		state := rt.Snapshot(nil)
+		counter := binary.LittleEndian.Uint32(state.Memory[MemUser:])
+		if state.Frame != want || uint64(counter) != want || state.Globals[0] != want {
+			t.Errorf("got frame %d, counter %d, global %d, want %d", state.Frame, counter, state.Globals[0], want)
+		}
+	}
+
+	if ok, _ := rewind.Step(); ok {
+		t.Error("rewound beyond the oldest frame")
+	}
+}
@@ -2,20 +2,15 @@ package runtime
 
 import (
 	"context"
+	"crypto/sha256"
 	_ "embed"
-	"fmt"
-	"image/png"
+	"image/color"
 	"io"
 	"log"
-	"os"
 	"path/filepath"
 	"strings"
 	"time"
 
-	"github.com/christopher-kleine/w4g/pkg/encoders"
-	"github.com/hajimehoshi/ebiten/v2"
-	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
-	"github.com/hajimehoshi/ebiten/v2/inpututil"
 	"github.com/tetratelabs/wazero"
 	"github.com/tetratelabs/wazero/api"
 )
@@ -24,71 +19,70 @@ const (
 	FlagPreserveScreen byte = 1
 )
 
-const (
-	PadIdle  byte = 0
-	PadX     byte = 1
-	PadY     byte = 1 << 1
-	PadLeft  byte = 1 << 4
-	PadRight byte = 1 << 5
-	PadUp    byte = 1 << 6
-	PadDown  byte = 1 << 7
-)
-
-var (
-	PlayerKeys = []map[ebiten.Key]byte{
-		{
-			ebiten.KeyLeft:  PadLeft,
-			ebiten.KeyRight: PadRight,
-			ebiten.KeyUp:    PadUp,
-			ebiten.KeyDown:  PadDown,
-			ebiten.KeyX:     PadX,
-			ebiten.KeySpace: PadX,
-			ebiten.KeyY:     PadY,
-			ebiten.KeyZ:     PadY,
-			ebiten.KeyC:     PadY,
-		},
-		{
-			ebiten.KeyS:   PadLeft,
-			ebiten.KeyF:   PadRight,
-			ebiten.KeyE:   PadUp,
-			ebiten.KeyD:   PadDown,
-			ebiten.KeyQ:   PadX,
-			ebiten.KeyTab: PadY,
-		},
-	}
-)
-
 // envWasm was compiled using `cd wasm; wat2wasm --debug-names env.wat`
 //
 //go:embed wasm/env.wasm
 var envWasm []byte
 
+// Runtime runs a single WASM-4 cart. It doesn't depend on any window, input
+// or audio backend: frontends feed the input of each frame into Step and
+// present the Framebuffer and AudioSamples afterwards.
 type Runtime struct {
 	runtime  wazero.Runtime
 	cart     api.Module
 	cartName string
+	cartPath string
+	cartHash [sha256.Size]byte
 	ctx      context.Context
-	showFPS  bool
-	Encoder  encoders.Encoder
 	VPU      *VPU
 	APU      *APU
 	Storage  io.ReadWriteCloser
+
+	// TraceSink receives the messages of the trace functions. If it is nil,
+	// they are written to stderr.
+	TraceSink TraceSink
+
+	// Budget limits the time start and every update may take. Zero means no
+	// limit. A frame that exceeds it is handled according to OnOverrun.
+	// Unless the policy is OverrunAbort, every frame costs a snapshot of
+	// the memory.
+	Budget    time.Duration
+	OnOverrun OverrunPolicy
+
+	frame       uint64
+	globals     []string
+	samples     []int16
+	initialDisk []byte
+
+	compiled wazero.CompiledModule
+	paused   *Overrun
+	before   *State
+
+	// Kept for crash reports.
+	crash       *Crash
+	functions   map[uint32]string
+	inputs      [crashInputs]InputState
+	inputsFrom  uint64
+	inputsEnd   uint64
+	recentTrace *MemorySink
 }
 
 var (
 	i32 = api.ValueTypeI32
 )
 
-func NewRuntime(showFPS bool) (*Runtime, error) {
+func NewRuntime() (*Runtime, error) {
 	var err error
 
 	result := &Runtime{
-		showFPS: showFPS,
+		recentTrace: NewMemorySink(crashTraces),
 	}
 
 	result.ctx = context.Background()
 
-	result.runtime = wazero.NewRuntime(result.ctx)
+	// Lets the Budget interrupt carts that never return
+	config := wazero.NewRuntimeConfig().WithCloseOnContextDone(true)
+	result.runtime = wazero.NewRuntimeWithConfig(result.ctx, config)
 
 	builder := result.runtime.NewHostModuleBuilder("goenv")
 	_, err = builder.
@@ -162,7 +156,7 @@ func NewRuntime(showFPS bool) (*Runtime, error) {
 		Export("traceUtf16").
 		NewFunctionBuilder().
 		WithGoModuleFunction(api.GoModuleFunc(result.tracef), []api.ValueType{i32, i32}, []api.ValueType{}).
-		WithParameterNames("str", "byteLength").
+		WithParameterNames("str", "stack").
 		Export("tracef").
 		Instantiate(result.ctx)
 
@@ -185,38 +179,97 @@ func (rt *Runtime) LoadCart(code []byte, name string) error {
 	var err error
 
 	rt.cartName = filepath.Base(name)
+	rt.cartPath = strings.TrimSuffix(name, filepath.Ext(name))
+	rt.cartHash = sha256.Sum256(code)
 
-	rt.Storage = NewStorage(strings.TrimSuffix(name, filepath.Ext(name)) + ".disk")
-	rt.APU = &APU{}
+	diags := Validate(code)
+	if diags.Failed() {
+		return diags
+	}
+	for _, diag := range diags {
+		log.Printf("%s: %s", rt.cartName, diag)
+	}
 
-	rt.cart, err = rt.runtime.Instantiate(rt.ctx, code)
-	if err != nil {
-		return err
+	// Replays provide their own disk
+	if rt.Storage == nil {
+		rt.Storage = NewStorage(rt.cartPath + ".disk")
 	}
+	rt.APU = NewAPU()
+
+	rt.initialDisk = make([]byte, 1024)
+	n, _ := rt.Storage.Read(rt.initialDisk)
+	rt.initialDisk = rt.initialDisk[:n]
+
+	rt.functions = functionNames(code)
+	code, rt.globals = exportGlobals(code)
 
-	rt.VPU = &VPU{
-		Memory: rt.cart.Memory,
+	rt.compiled, err = rt.runtime.CompileModule(rt.ctx, code)
+	if err == nil {
+		err = rt.instantiate()
 	}
+	if err != nil {
+		return diags.wrap(err)
+	}
+
+	return rt.start()
+}
 
+// start initializes a fresh instance of the cart and runs its start
+// function.
+func (rt *Runtime) start() error {
 	rt.VPU.Init()
 
-	rt.ApplyHacks()
+	// Only a hack that hangs stops the cart, other errors it survives
+	err := rt.ApplyHacks()
+	if timedOut(err) {
+		return rt.overrun(nil)
+	}
 
 	fn := rt.cart.ExportedFunction("start")
 	if fn != nil {
-		fn.Call(rt.ctx)
+		err := rt.call(fn)
+		if timedOut(err) {
+			return rt.overrun(nil)
+		}
+		if err != nil {
+			return rt.crashed(err)
+		}
 	}
 
 	return nil
 }
 
-func (rt *Runtime) ApplyHacks() {
+// CartName returns the file name of the loaded cart.
+func (rt *Runtime) CartName() string {
+	return rt.cartName
+}
+
+// Frame returns the number of frames the cart ran.
+func (rt *Runtime) Frame() uint64 {
+	return rt.frame
+}
+
+// CartHash returns the SHA-256 of the loaded cart.
+func (rt *Runtime) CartHash() [sha256.Size]byte {
+	return rt.cartHash
+}
+
+// InitialDisk returns the disk contents the cart found when it was loaded.
+func (rt *Runtime) InitialDisk() []byte {
+	return rt.initialDisk
+}
+
+// ApplyHacks runs the workarounds specific carts need before start, within
+// the Budget.
+func (rt *Runtime) ApplyHacks() error {
 	// Samurai Revenge - Load game on start
 	fn := rt.cart.ExportedFunction("loadGame")
 	if fn != nil {
 		log.Println("loadGame")
-		fn.Call(rt.ctx)
+		return rt.call(fn)
 	}
+
+	return nil
 }
 
 func (rt *Runtime) Close() error {
@@ -231,123 +284,90 @@ func (rt *Runtime) Close() error {
 	return nil
 }
 
-func (rt *Runtime) Screenshot(screen *ebiten.Image) {
-	udir, err := os.UserHomeDir()
-	if err != nil {
-		log.Println(err)
-		return
+// Step runs a single frame of the cart with the given input. The APU
+// advances by exactly one tick per frame, so running the same cart with the
+// same input always produces the same picture and audio.
+//
+// If update fails, the cart crashes: Step returns a *Crash and keeps
+// returning it without running the cart until a state is restored. A frame
+// that exceeds the Budget returns an *Overrun instead, unless the policy is
+// OverrunAbort.
+func (rt *Runtime) Step(input InputState) error {
+	if rt.crash != nil {
+		return rt.crash
 	}
-
-	fname := fmt.Sprintf("%s_%v.png", rt.cartName, time.Now().Format("2006-01-02_15-04-05"))
-	fname = filepath.Join(udir, fname)
-	f, err := os.Create(fname)
-	if err != nil {
-		log.Println(err)
-		return
+	if rt.paused != nil {
+		return rt.paused
 	}
 
-	err = png.Encode(f, screen)
-	if err != nil {
-		log.Println(err)
-	}
-}
-
-func (rt *Runtime) Draw(screen *ebiten.Image) {
-	rt.VPU.Render(screen)
+	input.write(rt.cart.Memory())
+	rt.recordInput(input)
 
-	if inpututil.IsKeyJustPressed(ebiten.KeyF9) {
-		rt.Screenshot(screen)
+	SystemFlags, _ := rt.cart.Memory().ReadByte(MemSystemFlags)
+	if SystemFlags&FlagPreserveScreen == 0 {
+		rt.VPU.Clear()
 	}
 
-	if rt.Encoder.IsRunning() {
-		rt.Encoder.Encode(screen)
+	// Only a Budget can close the cart in the middle of a frame, and only
+	// skipping and pausing go on from the state ahead of it
+	var before *State
+	if rt.Budget > 0 && rt.OnOverrun != OverrunAbort {
+		rt.before = rt.snapshot(rt.before, false)
+		before = rt.before
 	}
 
-	if rt.showFPS {
-		ebitenutil.DebugPrintAt(screen, fmt.Sprintf("%.f", ebiten.CurrentFPS()), 0, 0)
+	err := rt.call(rt.cart.ExportedFunction("update"))
+	if timedOut(err) {
+		return rt.overrun(before)
 	}
-
-	if rt.Encoder.IsRunning() {
-		ebitenutil.DebugPrintAt(screen, "REC", 160-24, 0)
+	if err != nil {
+		return rt.crashed(err)
 	}
-}
 
-func (rt *Runtime) KeyState(id byte) byte {
-	result := PadIdle
+	rt.frame++
 
-	for key, value := range PlayerKeys[id] {
-		if ebiten.IsKeyPressed(key) {
-			result = result | value
-		}
+	if rt.samples == nil {
+		rt.samples = make([]int16, SamplesPerFrame*2)
 	}
 
-	return result
+	rt.APU.Samples(rt.samples)
+
+	return nil
 }
 
-func (rt *Runtime) GamepadState(current byte, id ebiten.GamepadID) byte {
-	if ebiten.IsGamepadButtonPressed(id, ebiten.GamepadButton0) {
-		current = current | PadX
-	}
+// AudioSamples returns the interleaved stereo samples the APU produced
+// during the last frame. The slice is reused by the next frame.
+func (rt *Runtime) AudioSamples() []int16 {
+	return rt.samples
+}
 
-	if ebiten.IsGamepadButtonPressed(id, ebiten.GamepadButton1) {
-		current = current | PadY
-	}
+// Framebuffer returns the 2bpp framebuffer of the cart. Every byte holds
+// four pixels, the leftmost one in the lowest bits. The slice is a view into
+// the cart memory and changes with every frame.
+func (rt *Runtime) Framebuffer() []byte {
+	framebuffer, _ := rt.cart.Memory().Read(MemFramebuffer, SizeFramebuffer)
 
-	return current
+	return framebuffer
 }
 
-func (rt *Runtime) Update() error {
-	SystemFlags, _ := rt.cart.Memory().ReadByte(MemSystemFlags)
-	if SystemFlags&FlagPreserveScreen == 0 {
-		rt.VPU.Clear()
-	}
+// Memory returns the memory of the cart.
+func (rt *Runtime) Memory() api.Memory {
+	return rt.cart.Memory()
+}
 
-	if inpututil.IsKeyJustPressed(ebiten.KeyF10) {
-		if rt.Encoder.IsRunning() {
-			rt.Encoder.Stop()
-		} else {
-			rt.Encoder.Start(rt.cartName)
+// Palette returns the four colors of the current palette.
+func (rt *Runtime) Palette() [4]color.RGBA {
+	var colors [4]color.RGBA
+
+	palette, _ := rt.cart.Memory().Read(MemPalette, SizePalette)
+	for i := range colors {
+		colors[i] = color.RGBA{
+			A: 0xff,
+			R: palette[i*4+2],
+			G: palette[i*4+1],
+			B: palette[i*4+0],
 		}
 	}
 
-	if inpututil.IsKeyJustPressed(ebiten.KeyF11) {
-		rt.showFPS = !rt.showFPS
-	}
-	if inpututil.IsKeyJustPressed(ebiten.KeyF12) {
-		if ebiten.CursorMode() == ebiten.CursorModeVisible {
-			ebiten.SetCursorMode(ebiten.CursorModeHidden)
-		} else {
-			ebiten.SetCursorMode(ebiten.CursorModeVisible)
-		}
-	}
-
-	x, y := ebiten.CursorPosition()
-	rt.cart.Memory().WriteByte(MemMouseX, byte(x))
-	rt.cart.Memory().WriteByte(MemMouseY, byte(y))
-
-	button := byte(0)
-	if ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft) {
-		button = button | 1
-	}
-	if ebiten.IsMouseButtonPressed(ebiten.MouseButtonRight) {
-		button = button | 2
-	}
-	if ebiten.IsMouseButtonPressed(ebiten.MouseButtonMiddle) {
-		button = button | 4
-	}
-	rt.cart.Memory().WriteByte(MemMouseButtons, button)
-
-	rt.cart.Memory().WriteByte(MemGamepads+0*SizeGamepads, rt.KeyState(0))
-	rt.cart.Memory().WriteByte(MemGamepads+1*SizeGamepads, rt.KeyState(1))
-	// rt.cart.Memory().WriteByte(MemGamepads+2*SizeGamepads, rt.KeyState(Player3Keys))
-	// rt.cart.Memory().WriteByte(MemGamepads+3*SizeGamepads, rt.KeyState(Player4Keys))
-
-	_, err := rt.cart.ExportedFunction("update").Call(rt.ctx)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return colors
 }
-
-func (rt *Runtime) Layout(int, int) (int, int) { return 160, 160 }
@@ -0,0 +1,193 @@
+package runtime
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/christopher-kleine/w4g/pkg/wasm"
+	"github.com/tetratelabs/wazero/api"
+)
+
+// globalPrefix names the exports LoadCart adds for the mutable globals of a
+// cart. wazero only gives access to exported globals, but the stack pointer
+// and the globals of most languages are never exported by the cart itself.
+const globalPrefix = "__w4g_global_"
+
+const stateVersion = 1
+
+var ErrWrongCart = errors.New("save state belongs to a different cart")
+
+// State is a snapshot of everything a cart can observe: its memory, its
+// globals, the sound that's currently playing and the disk.
+type State struct {
+	Frame   uint64
+	Memory  []byte
+	Globals []uint64
+	APU     []byte
+	Disk    []byte
+}
+
+type stateFile struct {
+	Version int
+	Cart    [sha256.Size]byte
+	State   *State
+}
+
+// exportGlobals rewrites the cart to export all of its mutable globals. It
+// returns the unchanged code if the cart can't be parsed, leaving the error
+// reporting to wazero.
+func exportGlobals(code []byte) ([]byte, []string) {
+	m, err := wasm.Parse(code)
+	if err != nil {
+		return code, nil
+	}
+
+	var names []string
+	base := m.ImportedGlobals()
+	for i, global := range m.Globals {
+		if !global.Mutable {
+			continue
+		}
+
+		name := fmt.Sprintf("%s%d", globalPrefix, i)
+		m.Exports = append(m.Exports, wasm.Export{
+			Name:  name,
+			Type:  wasm.ExternGlobal,
+			Index: base + uint32(i),
+		})
+		names = append(names, name)
+	}
+
+	if len(names) == 0 {
+		return code, nil
+	}
+
+	return m.Encode(), names
+}
+
+// Snapshot captures the current state of the cart. If dst is not nil, its
+// buffers are reused.
+func (rt *Runtime) Snapshot(dst *State) *State {
+	return rt.snapshot(dst, true)
+}
+
+func (rt *Runtime) snapshot(dst *State, disk bool) *State {
+	if dst == nil {
+		dst = &State{}
+	}
+
+	dst.Frame = rt.frame
+
+	mem := rt.cart.Memory()
+	data, _ := mem.Read(0, mem.Size())
+	dst.Memory = append(dst.Memory[:0], data...)
+
+	dst.Globals = dst.Globals[:0]
+	for _, name := range rt.globals {
+		dst.Globals = append(dst.Globals, rt.cart.ExportedGlobal(name).Get())
+	}
+
+	dst.APU, _ = rt.APU.MarshalBinary()
+
+	if disk {
+		data := make([]byte, 1024)
+		n, _ := rt.Storage.Read(data)
+		dst.Disk = data[:n]
+	}
+
+	return dst
+}
+
+// Restore resets the cart to a previously captured state.
+func (rt *Runtime) Restore(state *State) error {
+	return rt.restore(state, true)
+}
+
+func (rt *Runtime) restore(state *State, disk bool) error {
+	if len(state.Globals) != len(rt.globals) {
+		return ErrWrongCart
+	}
+
+	if !rt.cart.Memory().Write(0, state.Memory) {
+		return ErrWrongCart
+	}
+
+	rt.frame = state.Frame
+	rt.forgetInputs(state.Frame)
+	rt.crash = nil
+	rt.paused = nil
+
+	for i, name := range rt.globals {
+		global, ok := rt.cart.ExportedGlobal(name).(api.MutableGlobal)
+		if ok {
+			global.Set(state.Globals[i])
+		}
+	}
+
+	err := rt.APU.UnmarshalBinary(state.APU)
+	if err != nil || !disk {
+		return err
+	}
+
+	_, err = rt.Storage.Write(state.Disk)
+
+	return err
+}
+
+// SaveState writes a compressed snapshot of the cart to w.
+func (rt *Runtime) SaveState(w io.Writer) error {
+	zw := gzip.NewWriter(w)
+
+	err := gob.NewEncoder(zw).Encode(stateFile{
+		Version: stateVersion,
+		Cart:    rt.cartHash,
+		State:   rt.Snapshot(nil),
+	})
+	if err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+// LoadState restores a snapshot written by SaveState. It fails with
+// ErrWrongCart if the snapshot was taken with a different cart.
+func (rt *Runtime) LoadState(r io.Reader) error {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	var file stateFile
+	err = gob.NewDecoder(zr).Decode(&file)
+	if err != nil {
+		return err
+	}
+
+	// Only the end of the stream tells whether the checksum matches
+	_, err = io.Copy(io.Discard, zr)
+	if err != nil {
+		return err
+	}
+
+	if file.Version != stateVersion {
+		return fmt.Errorf("unsupported save state version %d", file.Version)
+	}
+
+	if file.Cart != rt.cartHash || file.State == nil {
+		return ErrWrongCart
+	}
+
+	return rt.Restore(file.State)
+}
+
+// StateFile returns the file of a numbered save state slot. It lives next
+// to the disk file of the cart.
+func (rt *Runtime) StateFile(slot int) string {
+	return fmt.Sprintf("%s.state%d", rt.cartPath, slot)
+}
@@ -0,0 +1,226 @@
+package runtime
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/christopher-kleine/w4g/pkg/wasm"
+	"github.com/tetratelabs/wazero/api"
+)
+
+// writeStateFile writes a save state the way SaveState does, but with any
+// content.
+func writeStateFile(t *testing.T, file stateFile) *bytes.Buffer {
+	t.Helper()
+
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	err := gob.NewEncoder(zw).Encode(file)
+	if err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &b
+}
+
+func TestExportGlobals(t *testing.T) {
+	code, names := exportGlobals(readTestCart(t, "globals"))
+
+	// The immutable global at 1 isn't exported
+	want := []struct {
+		index uint32
+		typ   wasm.ValueType
+	}{
+		{0, wasm.I32},
+		{2, wasm.I64},
+		{3, wasm.F32},
+	}
+	if len(names) != len(want) {
+		t.Fatalf("exported %v", names)
+	}
+
+	m, err := wasm.Parse(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exports := make(map[string]wasm.Export)
+	for _, exp := range m.Exports {
+		exports[exp.Name] = exp
+	}
+	for i, w := range want {
+		name := fmt.Sprintf("%s%d", globalPrefix, w.index)
+		exp, ok := exports[name]
+		if names[i] != name || !ok {
+			t.Fatalf("global %d isn't exported as %s, got %v", w.index, name, names)
+		}
+		if exp.Type != wasm.ExternGlobal || exp.Index != w.index {
+			t.Errorf("%s exports %s %d", name, exp.Type, exp.Index)
+		}
+		if g := m.Globals[exp.Index]; !g.Mutable || g.Type != w.typ {
+			t.Errorf("%s is %+v, want a mutable %s", name, g.GlobalType, w.typ)
+		}
+	}
+
+	// wazero sees the same globals
+	rt := loadTestCart(t, "globals", nil)
+	stepFrames(t, rt, 2)
+
+	types := []api.ValueType{api.ValueTypeI32, api.ValueTypeI64, api.ValueTypeF32}
+	for i, name := range rt.globals {
+		if got := rt.cart.ExportedGlobal(name).Type(); got != types[i] {
+			t.Errorf("%s is %s, want %s", name, api.ValueTypeName(got), api.ValueTypeName(types[i]))
+		}
+	}
+
+	state := rt.Snapshot(nil)
+	if len(state.Globals) != 3 || state.Globals[0] != 2 || state.Globals[1] != 1 || math.Float32frombits(uint32(state.Globals[2])) != 0.5 {
+		t.Errorf("globals %v after 2 frames", state.Globals)
+	}
+}
+
+func TestExportGlobalsWithoutGlobals(t *testing.T) {
+	// A cart without mutable globals is left alone
+	code := readTestCart(t, "input")
+	exported, names := exportGlobals(code)
+	if len(names) != 0 || !bytes.Equal(exported, code) {
+		t.Errorf("exported %v", names)
+	}
+}
+
+func TestStateRoundTrip(t *testing.T) {
+	rt := loadTestCart(t, "counter", nil)
+
+	stepFrames(t, rt, 3)
+	rt.APU.Tone(440, 60, 50, 0)
+	rt.APU.Samples(make([]int16, 256))
+
+	var saved bytes.Buffer
+	err := rt.SaveState(&saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := rt.Snapshot(nil)
+
+	stepFrames(t, rt, 2)
+	rt.APU.Tone(880, 10, 100, 1)
+
+	err = rt.LoadState(&saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := rt.Snapshot(nil)
+
+	if got.Frame != want.Frame {
+		t.Errorf("frame %d, want %d", got.Frame, want.Frame)
+	}
+	if !bytes.Equal(got.Memory, want.Memory) {
+		t.Error("memory differs")
+	}
+	if !reflect.DeepEqual(got.Globals, want.Globals) {
+		t.Errorf("globals %v, want %v", got.Globals, want.Globals)
+	}
+	if !bytes.Equal(got.APU, want.APU) {
+		t.Error("APU differs")
+	}
+
+	// The cart continues from the restored frame
+	stepFrames(t, rt, 1)
+	if counter, _ := rt.Memory().ReadUint32Le(MemUser); counter != 4 {
+		t.Errorf("counter is %d after the next frame, want 4", counter)
+	}
+}
+
+func TestLoadStateWrongCart(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(file *stateFile)
+	}{
+		{"hash", func(file *stateFile) { file.Cart[0] ^= 0xff }},
+		{"fewer globals", func(file *stateFile) { file.State.Globals = nil }},
+		{"more globals", func(file *stateFile) { file.State.Globals = append(file.State.Globals, 0) }},
+		{"no state", func(file *stateFile) { file.State = nil }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt := loadTestCart(t, "counter", nil)
+			stepFrames(t, rt, 2)
+
+			file := stateFile{
+				Version: stateVersion,
+				Cart:    rt.cartHash,
+				State:   rt.Snapshot(nil),
+			}
+			test.modify(&file)
+
+			err := rt.LoadState(writeStateFile(t, file))
+			if !errors.Is(err, ErrWrongCart) {
+				t.Errorf("got %v, want ErrWrongCart", err)
+			}
+			if rt.Frame() != 2 {
+				t.Errorf("frame changed to %d", rt.Frame())
+			}
+		})
+	}
+}
+
+func TestLoadStateCorrupted(t *testing.T) {
+	rt := loadTestCart(t, "counter", nil)
+	stepFrames(t, rt, 2)
+
+	var saved bytes.Buffer
+	err := rt.SaveState(&saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := saved.Bytes()
+
+	corrupted := append([]byte{}, data...)
+	corrupted[len(corrupted)/2] ^= 0xff
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"no gzip", []byte("not a save state")},
+		{"corrupted", corrupted},
+		{"truncated", data[:len(data)/2]},
+		{"no checksum", data[:len(data)-4]},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := rt.LoadState(bytes.NewReader(test.data))
+			if err == nil {
+				t.Error("no error")
+			}
+			if rt.Frame() != 2 {
+				t.Errorf("frame changed to %d", rt.Frame())
+			}
+		})
+	}
+}
+
+func TestLoadStateVersion(t *testing.T) {
+	rt := loadTestCart(t, "counter", nil)
+
+	err := rt.LoadState(writeStateFile(t, stateFile{
+		Version: stateVersion + 1,
+		Cart:    rt.cartHash,
+		State:   rt.Snapshot(nil),
+	}))
+	if err == nil || errors.Is(err, ErrWrongCart) {
+		t.Errorf("got %v, want an unsupported version", err)
+	}
+}
@@ -37,6 +37,14 @@ func NewStorage(filename string) *Storage {
 	}
 }
 
+// NewMemoryStorage creates a storage holding data that is never written to
+// a file.
+func NewMemoryStorage(data []byte) *Storage {
+	return &Storage{
+		Data: append([]byte{}, data...),
+	}
+}
+
 func (s *Storage) Read(p []byte) (n int, err error) {
 	n = copy(p, s.Data)
 
@@ -51,7 +59,7 @@ func (s *Storage) Write(p []byte) (n int, err error) {
 }
 
 func (s *Storage) Close() error {
-	if len(s.Data) == 0 {
+	if len(s.Data) == 0 || s.Filename == "" {
 		return nil
 	}
 
@@ -74,9 +82,10 @@ func (rt *Runtime) diskr(ctx context.Context, mod api.Module, stack []uint64) {
 	var (
 		dest = api.DecodeI32(stack[0])
 		size = api.DecodeI32(stack[1])
-		data = make([]byte, size)
 	)
 
+	checkLength("diskr", "size", size)
+
 	if rt.cart == nil || rt.cart.Memory() == nil {
 		stack[0] = 0
 		return
@@ -86,16 +95,10 @@ func (rt *Runtime) diskr(ctx context.Context, mod api.Module, stack []uint64) {
 		size = 1024
 	}
 
-	n, err := rt.Storage.Read(data)
-	if err != nil || int32(n) != size {
-		stack[0] = 0
-		return
-	}
-
-	data = data[:n]
+	data := readMemory(rt.cart.Memory(), "diskr", "dest", dest, uint32(size))
 
-	ok := rt.cart.Memory().Write(uint32(dest), data)
-	if !ok {
+	n, err := rt.Storage.Read(data)
+	if err != nil && err != io.EOF {
 		stack[0] = 0
 		return
 	}
@@ -111,6 +114,8 @@ func (rt *Runtime) diskw(ctx context.Context, mod api.Module, stack []uint64) {
 		size = api.DecodeI32(stack[1])
 	)
 
+	checkLength("diskw", "size", size)
+
 	if rt.cart == nil || rt.cart.Memory() == nil {
 		stack[0] = 0
 		return
@@ -120,11 +125,7 @@ func (rt *Runtime) diskw(ctx context.Context, mod api.Module, stack []uint64) {
 		size = 1024
 	}
 
-	data, ok := rt.cart.Memory().Read(uint32(src), uint32(size))
-	if !ok {
-		stack[0] = 0
-		return
-	}
+	data := readMemory(rt.cart.Memory(), "diskw", "src", src, uint32(size))
 
 	m, err := rt.Storage.Write(data)
 	if err != nil || int32(m) != size {
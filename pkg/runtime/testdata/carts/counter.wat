@@ -0,0 +1,9 @@
+;; counter.wasm counts the frames in a global and at the start of the user
+;; memory. Rebuild it with
+;; wat2wasm counter.wat -o counter.wasm
+(module
+  (import "env" "memory" (memory 1 1))
+  (global $frames (mut i32) (i32.const 0))
+  (func (export "update")
+    (global.set $frames (i32.add (global.get $frames) (i32.const 1)))
+    (i32.store (i32.const 0x19a0) (i32.add (i32.load (i32.const 0x19a0)) (i32.const 1)))))
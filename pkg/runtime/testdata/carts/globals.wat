@@ -0,0 +1,14 @@
+;; globals.wasm has mutable globals of three types with an immutable one in
+;; between, and changes all of them every frame. Rebuild it with
+;; wat2wasm globals.wat -o globals.wasm
+(module
+  (import "env" "memory" (memory 1 1))
+  (global $frames (mut i32) (i32.const 0))
+  (global $step f64 (f64.const 0.25))
+  (global $ticks (mut i64) (i64.const -1))
+  (global $phase (mut f32) (f32.const 0))
+  (func (export "update")
+    (global.set $frames (i32.add (global.get $frames) (i32.const 1)))
+    (global.set $ticks (i64.add (global.get $ticks) (i64.const 1)))
+    (global.set $phase
+      (f32.add (global.get $phase) (f32.demote_f64 (global.get $step))))))
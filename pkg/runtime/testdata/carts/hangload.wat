@@ -0,0 +1,8 @@
+;; hangload.wasm hangs forever in loadGame, which the runtime calls ahead of
+;; start for Samurai Revenge. Rebuild it with
+;; wat2wasm hangload.wat -o hangload.wasm
+(module
+  (import "env" "memory" (memory 1 1))
+  (func (export "loadGame")
+    (loop $forever (br $forever)))
+  (func (export "update")))
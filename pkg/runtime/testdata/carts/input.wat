@@ -0,0 +1,20 @@
+;; input.wasm draws the input of every frame into the framebuffer, which it
+;; keeps between frames, one byte per frame. The first byte of the disk is
+;; mixed in. Rebuild it with
+;; wat2wasm input.wat -o input.wasm
+(module
+  (import "env" "memory" (memory 1 1))
+  (import "env" "diskr" (func $diskr (param i32 i32) (result i32)))
+  (func (export "start")
+    ;; Preserve the framebuffer
+    (i32.store8 (i32.const 0x1f) (i32.const 1))
+    (drop (call $diskr (i32.const 0x19a4) (i32.const 1))))
+  (func (export "update")
+    (local $frame i32)
+    (local.set $frame (i32.load (i32.const 0x19a0)))
+    (i32.store8
+      (i32.add (i32.const 0xa0) (i32.rem_u (local.get $frame) (i32.const 6400)))
+      (i32.xor
+        (i32.xor (i32.load8_u (i32.const 0x16)) (i32.load8_u (i32.const 0x19a4)))
+        (i32.xor (i32.load8_u (i32.const 0x1a)) (i32.load8_u (i32.const 0x1e)))))
+    (i32.store (i32.const 0x19a0) (i32.add (local.get $frame) (i32.const 1)))))
@@ -0,0 +1,8 @@
+;; invalid.wasm breaks most rules Validate checks. Rebuild it with
+;; wat2wasm invalid.wat -o invalid.wasm
+(module
+  (import "wasi_snapshot_preview1" "fd_write" (func (param i32 i32 i32 i32) (result i32)))
+  (import "env" "rect" (func (param i32 i32 i32)))
+  (import "env" "sound" (func (param i32)))
+  (memory 1)
+  (func (export "start") (param i32)))
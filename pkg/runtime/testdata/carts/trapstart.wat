@@ -0,0 +1,7 @@
+;; trapstart.wasm traps in start. Rebuild it with
+;; wat2wasm trapstart.wat -o trapstart.wasm
+(module
+  (import "env" "memory" (memory 1 1))
+  (func (export "start")
+    unreachable)
+  (func (export "update")))
@@ -0,0 +1,219 @@
+package runtime
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// TraceEntry is a single message of a cart.
+type TraceEntry struct {
+	Time time.Time
+
+	// Frame is the number of frames the cart ran before the message. Messages
+	// of start have frame 0.
+	Frame uint64
+
+	// Source is the name of the function the cart called, like traceUtf8.
+	Source string
+
+	Message string
+}
+
+func (e TraceEntry) String() string {
+	return fmt.Sprintf("%s #%d %s: %s", e.Time.Format("15:04:05.000"), e.Frame, e.Source, e.Message)
+}
+
+// TraceSink receives the messages of the trace functions.
+type TraceSink interface {
+	Trace(entry TraceEntry)
+}
+
+// WriterSink writes every entry as a line to a writer.
+type WriterSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w}
+}
+
+// NewStderrSink writes to stderr. It is used if a Runtime has no sink.
+func NewStderrSink() *WriterSink {
+	return NewWriterSink(os.Stderr)
+}
+
+func (s *WriterSink) Trace(entry TraceEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fmt.Fprintln(s.w, entry)
+}
+
+// FileSink writes to a log file. Once the file exceeds its size, it is
+// renamed to name.1, the previous name.1 to name.2 and so on.
+type FileSink struct {
+	mu      sync.Mutex
+	name    string
+	maxSize int64
+	backups int
+	file    *os.File
+	size    int64
+}
+
+// NewFileSink appends to the file name. The file is rotated when it grows
+// beyond maxSize bytes, keeping up to backups old files.
+func NewFileSink(name string, maxSize int64, backups int) (*FileSink, error) {
+	s := &FileSink{
+		name:    name,
+		maxSize: maxSize,
+		backups: backups,
+	}
+
+	err := s.open()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *FileSink) open() error {
+	f, err := os.OpenFile(s.name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	s.file = f
+	s.size = info.Size()
+
+	return nil
+}
+
+func (s *FileSink) rotate() error {
+	s.file.Close()
+	s.file = nil
+
+	for i := s.backups; i > 0; i-- {
+		from := s.name
+		if i > 1 {
+			from = fmt.Sprintf("%s.%d", s.name, i-1)
+		}
+		os.Rename(from, fmt.Sprintf("%s.%d", s.name, i))
+	}
+	if s.backups == 0 {
+		os.Remove(s.name)
+	}
+
+	return s.open()
+}
+
+func (s *FileSink) Trace(entry TraceEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return
+	}
+
+	if s.size >= s.maxSize && s.size > 0 {
+		err := s.rotate()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return
+		}
+	}
+
+	n, _ := fmt.Fprintln(s.file, entry)
+	s.size += int64(n)
+}
+
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+
+	err := s.file.Close()
+	s.file = nil
+
+	return err
+}
+
+// MemorySink keeps the latest entries in memory.
+type MemorySink struct {
+	mu      sync.Mutex
+	entries []TraceEntry
+	next    int
+	full    bool
+}
+
+// NewMemorySink keeps up to capacity entries, dropping the oldest ones.
+func NewMemorySink(capacity int) *MemorySink {
+	return &MemorySink{
+		entries: make([]TraceEntry, capacity),
+	}
+}
+
+func (s *MemorySink) Trace(entry TraceEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.entries) == 0 {
+		return
+	}
+
+	s.entries[s.next] = entry
+	s.next = (s.next + 1) % len(s.entries)
+	if s.next == 0 {
+		s.full = true
+	}
+}
+
+// Entries returns a copy of the kept entries, the oldest first.
+func (s *MemorySink) Entries() []TraceEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.full {
+		return append([]TraceEntry{}, s.entries[:s.next]...)
+	}
+
+	return append(append([]TraceEntry{}, s.entries[s.next:]...), s.entries[:s.next]...)
+}
+
+// Clear drops all entries.
+func (s *MemorySink) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.next = 0
+	s.full = false
+}
+
+// MultiSink passes every entry to all of its sinks.
+type MultiSink []TraceSink
+
+func (m MultiSink) Trace(entry TraceEntry) {
+	for _, sink := range m {
+		sink.Trace(entry)
+	}
+}
+
+// TraceFunc adapts a function to a TraceSink.
+type TraceFunc func(entry TraceEntry)
+
+func (f TraceFunc) Trace(entry TraceEntry) {
+	f(entry)
+}
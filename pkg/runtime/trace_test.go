@@ -0,0 +1,171 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func entry(message string) TraceEntry {
+	return TraceEntry{Source: "trace", Message: message}
+}
+
+func TestFileSinkRotation(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "trace.log")
+
+	// Every line is longer than the limit, so each entry gets a file
+	sink, err := NewFileSink(name, 8, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 4; i++ {
+		sink.Trace(entry(fmt.Sprintf("message %d", i)))
+	}
+	err = sink.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		name:        "message 4",
+		name + ".1": "message 3",
+		name + ".2": "message 2",
+	}
+	for file, want := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		if len(lines) != 1 || !strings.HasSuffix(lines[0], want) {
+			t.Errorf("%s holds %q, want only %q", filepath.Base(file), data, want)
+		}
+	}
+
+	if _, err := os.Stat(name + ".3"); !os.IsNotExist(err) {
+		t.Errorf("more than 2 backups kept: %v", err)
+	}
+}
+
+func TestFileSinkLimit(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "trace.log")
+
+	line := fmt.Sprintln(entry("x"))
+	sink, err := NewFileSink(name, int64(3*len(line)), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		sink.Trace(entry("x"))
+	}
+	sink.Close()
+
+	// The file is rotated once it reached the limit, not before
+	for file, want := range map[string]int{name: 1, name + ".1": 3} {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Count(string(data), "\n"); got != want {
+			t.Errorf("%s has %d lines, want %d", filepath.Base(file), got, want)
+		}
+	}
+}
+
+func TestFileSinkNoBackups(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "trace.log")
+
+	sink, err := NewFileSink(name, 8, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.Trace(entry("first"))
+	sink.Trace(entry("second"))
+	sink.Close()
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "first") || !strings.Contains(string(data), "second") {
+		t.Errorf("got %q", data)
+	}
+	if _, err := os.Stat(name + ".1"); !os.IsNotExist(err) {
+		t.Errorf("backup kept: %v", err)
+	}
+}
+
+func TestMemorySink(t *testing.T) {
+	messages := func(entries []TraceEntry) string {
+		var m []string
+		for _, e := range entries {
+			m = append(m, e.Message)
+		}
+		return strings.Join(m, " ")
+	}
+
+	sink := NewMemorySink(3)
+	if got := messages(sink.Entries()); got != "" {
+		t.Errorf("new sink has %q", got)
+	}
+
+	tests := []struct {
+		message string
+		want    string
+	}{
+		{"a", "a"},
+		{"b", "a b"},
+		{"c", "a b c"},
+		{"d", "b c d"},
+		{"e", "c d e"},
+		{"f", "d e f"},
+		{"g", "e f g"},
+	}
+	for _, test := range tests {
+		sink.Trace(entry(test.message))
+		if got := messages(sink.Entries()); got != test.want {
+			t.Errorf("after %s got %q, want %q", test.message, got, test.want)
+		}
+	}
+
+	sink.Clear()
+	sink.Trace(entry("h"))
+	if got := messages(sink.Entries()); got != "h" {
+		t.Errorf("after Clear got %q, want %q", got, "h")
+	}
+}
+
+func TestMemorySinkEmpty(t *testing.T) {
+	sink := NewMemorySink(0)
+	sink.Trace(entry("a"))
+
+	if entries := sink.Entries(); len(entries) != 0 {
+		t.Errorf("got %v", entries)
+	}
+}
+
+func TestTraceFrame(t *testing.T) {
+	rt, mod := newTestRuntime(t)
+
+	sink := NewMemorySink(4)
+	rt.TraceSink = sink
+
+	mod.Memory().Write(0x2000, []byte("hi\x00"))
+	rt.trace(context.TODO(), mod, []uint64{0x2000})
+	rt.frame = 42
+	rt.trace(context.TODO(), mod, []uint64{0x2000})
+
+	entries := sink.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	if entries[0].Frame != 0 || entries[1].Frame != 42 {
+		t.Errorf("frames %d and %d, want 0 and 42", entries[0].Frame, entries[1].Frame)
+	}
+	if !strings.Contains(entries[1].String(), "#42 trace: hi") {
+		t.Errorf("entry reads %q", entries[1])
+	}
+}
@@ -0,0 +1,73 @@
+package runtime
+
+import (
+	"fmt"
+
+	"github.com/tetratelabs/wazero/api"
+)
+
+// Trap aborts a cart that passed an invalid argument to a host function.
+//
+// Host functions panic with a *Trap. wazero recovers the panic and returns
+// it, wrapped, as the error of the call into the cart, so errors.As finds it
+// in the errors of LoadCart and Step.
+type Trap struct {
+	// Function is the name of the host function, like blit.
+	Function string
+
+	// Argument is the name of the invalid argument.
+	Argument string
+
+	Message string
+}
+
+func (t *Trap) Error() string {
+	return fmt.Sprintf("%s: invalid %s: %s", t.Function, t.Argument, t.Message)
+}
+
+// trap aborts the cart.
+func trap(function, argument, format string, args ...interface{}) {
+	panic(&Trap{
+		Function: function,
+		Argument: argument,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// checkLength traps if a length is negative. Lengths are unsigned in the
+// WASM-4 API, so a negative one is almost 4 GiB and always a bug.
+func checkLength(function, argument string, length int32) {
+	if length < 0 {
+		trap(function, argument, "%d is negative", length)
+	}
+}
+
+// readMemory returns size bytes of the memory at ptr. It traps if they are
+// not all within the memory.
+func readMemory(mem api.Memory, function, argument string, ptr int32, size uint32) []byte {
+	data, ok := mem.Read(uint32(ptr), size)
+	if !ok {
+		trap(function, argument, "%d bytes at %#x are outside of the memory", size, uint32(ptr))
+	}
+
+	return data
+}
+
+// getString returns the zero-terminated string at ptr, without the zero. It
+// traps if the string runs past the end of the memory.
+func getString(mem api.Memory, function, argument string, ptr int32) []byte {
+	if uint32(ptr) >= mem.Size() {
+		trap(function, argument, "string at %#x is outside of the memory", uint32(ptr))
+	}
+
+	data, _ := mem.Read(uint32(ptr), mem.Size()-uint32(ptr))
+	for i, c := range data {
+		if c == 0 {
+			return append([]byte{}, data[:i]...)
+		}
+	}
+
+	trap(function, argument, "string at %#x is not zero-terminated", uint32(ptr))
+
+	return nil
+}
@@ -0,0 +1,171 @@
+package runtime
+
+import (
+	"context"
+	"testing"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+)
+
+// newTestRuntime creates a Runtime on a blank memory, so host functions can
+// be called directly.
+func newTestRuntime(t *testing.T) (*Runtime, api.Module) {
+	t.Helper()
+
+	ctx := context.Background()
+	r := wazero.NewRuntime(ctx)
+	t.Cleanup(func() { r.Close(ctx) })
+
+	mod, err := r.Instantiate(ctx, memoryModule)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rt := &Runtime{
+		ctx:       ctx,
+		cart:      mod,
+		VPU:       NewVPU(mod.Memory()),
+		Storage:   NewMemoryStorage([]byte("disk")),
+		TraceSink: TraceFunc(func(TraceEntry) {}),
+	}
+	rt.VPU.Init()
+
+	return rt, mod
+}
+
+// call runs fn and returns the Trap it panicked with, if any.
+func call(fn func()) (trap *Trap) {
+	defer func() {
+		if r := recover(); r != nil {
+			trap = r.(*Trap)
+		}
+	}()
+
+	fn()
+
+	return nil
+}
+
+func TestHostFunctionTraps(t *testing.T) {
+	const end = 0x10000
+
+	tests := []struct {
+		name     string
+		call     func(rt *Runtime, mod api.Module)
+		function string
+		argument string
+	}{
+		{"blit_outside", func(rt *Runtime, mod api.Module) { rt.blit(context.TODO(), mod, []uint64{end - 8, 0, 0, 8, 8, 1}) }, "blit", "sprite"},
+		{"blit_width", func(rt *Runtime, mod api.Module) {
+			rt.blit(context.TODO(), mod, []uint64{0, 0, 0, api.EncodeI32(-8), 8, 0})
+		}, "blit", "width"},
+		{"blit_sub_stride", func(rt *Runtime, mod api.Module) {
+			rt.blitSub(context.TODO(), mod, []uint64{0, 0, 0, 8, 8, 0, 0, api.EncodeI32(-1), 0})
+		}, "blitSub", "stride"},
+		{"blit_sub_huge", func(rt *Runtime, mod api.Module) {
+			rt.blitSub(context.TODO(), mod, []uint64{0, 0, 0, 8, 8, 0, 0x7fffffff, 0x7fffffff, 0})
+		}, "blitSub", "sprite"},
+		{"hline_len", func(rt *Runtime, mod api.Module) { rt.hline(context.TODO(), []uint64{0, 0, api.EncodeI32(-1)}) }, "hline", "len"},
+		{"vline_len", func(rt *Runtime, mod api.Module) { rt.vline(context.TODO(), []uint64{0, 0, api.EncodeI32(-1)}) }, "vline", "len"},
+		{"rect_width", func(rt *Runtime, mod api.Module) { rt.rect(context.TODO(), []uint64{0, 0, api.EncodeI32(-1), 1}) }, "rect", "width"},
+		{"oval_height", func(rt *Runtime, mod api.Module) { rt.oval(context.TODO(), []uint64{0, 0, 1, api.EncodeI32(-1)}) }, "oval", "height"},
+		{"text_outside", func(rt *Runtime, mod api.Module) { rt.text(context.TODO(), mod, []uint64{end, 0, 0}) }, "text", "str"},
+		{"text_unterminated", func(rt *Runtime, mod api.Module) {
+			mod.Memory().WriteByte(end-1, 'A')
+			rt.text(context.TODO(), mod, []uint64{end - 1, 0, 0})
+		}, "text", "str"},
+		{"text_utf8_length", func(rt *Runtime, mod api.Module) {
+			rt.textUtf8(context.TODO(), mod, []uint64{0, api.EncodeI32(-1), 0, 0})
+		}, "textUtf8", "byteLength"},
+		{"text_utf16_outside", func(rt *Runtime, mod api.Module) { rt.textUtf16(context.TODO(), mod, []uint64{end - 2, 4, 0, 0}) }, "textUtf16", "str"},
+		{"trace_outside", func(rt *Runtime, mod api.Module) { rt.trace(context.TODO(), mod, []uint64{api.EncodeI32(-1)}) }, "trace", "str"},
+		{"trace_utf8_outside", func(rt *Runtime, mod api.Module) { rt.traceUtf8(context.TODO(), mod, []uint64{end, 1}) }, "traceUtf8", "str"},
+		{"trace_utf16_length", func(rt *Runtime, mod api.Module) { rt.traceUtf16(context.TODO(), mod, []uint64{0, api.EncodeI32(-2)}) }, "traceUtf16", "byteLength"},
+		{"tracef_stack", func(rt *Runtime, mod api.Module) {
+			mod.Memory().Write(0x2000, []byte("%d\x00"))
+			rt.tracef(context.TODO(), mod, []uint64{0x2000, end - 2})
+		}, "tracef", "stack"},
+		{"tracef_string_argument", func(rt *Runtime, mod api.Module) {
+			mod.Memory().Write(0x2000, []byte("%s\x00"))
+			mod.Memory().WriteUint32Le(0x2010, end)
+			rt.tracef(context.TODO(), mod, []uint64{0x2000, 0x2010})
+		}, "tracef", "stack"},
+		{"diskr_size", func(rt *Runtime, mod api.Module) { rt.diskr(context.TODO(), mod, []uint64{0, api.EncodeI32(-1)}) }, "diskr", "size"},
+		{"diskr_outside", func(rt *Runtime, mod api.Module) { rt.diskr(context.TODO(), mod, []uint64{end - 2, 4}) }, "diskr", "dest"},
+		{"diskw_outside", func(rt *Runtime, mod api.Module) { rt.diskw(context.TODO(), mod, []uint64{end - 2, 4}) }, "diskw", "src"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rt, mod := newTestRuntime(t)
+
+			trap := call(func() { test.call(rt, mod) })
+			if trap == nil {
+				t.Fatal("no trap")
+			}
+			if trap.Function != test.function || trap.Argument != test.argument {
+				t.Errorf("trapped in %s with %s, want %s with %s (%v)", trap.Function, trap.Argument, test.function, test.argument, trap)
+			}
+		})
+	}
+}
+
+func TestHostFunctionsAtEndOfMemory(t *testing.T) {
+	const end = 0x10000
+
+	rt, mod := newTestRuntime(t)
+
+	// An 8x8 2bpp sprite takes exactly 16 bytes
+	if trap := call(func() { rt.blit(context.TODO(), mod, []uint64{end - 16, 0, 0, 8, 8, 1}) }); trap != nil {
+		t.Error(trap)
+	}
+
+	mod.Memory().Write(end-3, []byte("Hi\x00"))
+	if trap := call(func() { rt.text(context.TODO(), mod, []uint64{end - 3, 0, 0}) }); trap != nil {
+		t.Error(trap)
+	}
+
+	if trap := call(func() { rt.textUtf8(context.TODO(), mod, []uint64{end, 0, 0, 0}) }); trap != nil {
+		t.Error(trap)
+	}
+}
+
+func TestDiskrShortDisk(t *testing.T) {
+	rt, mod := newTestRuntime(t)
+
+	stack := []uint64{0x2000, 16}
+	rt.diskr(context.TODO(), mod, stack)
+	if stack[0] != 4 {
+		t.Errorf("diskr returned %d, want 4", stack[0])
+	}
+
+	data, _ := mod.Memory().Read(0x2000, 4)
+	if string(data) != "disk" {
+		t.Errorf("diskr read %q", data)
+	}
+}
+
+func TestHostHLine(t *testing.T) {
+	rt, mod := newTestRuntime(t)
+	mod.Memory().WriteUint16Le(MemDrawColors, 0x0003)
+
+	rt.hline(context.TODO(), []uint64{10, 1, 3})
+
+	want := "................\n" +
+		"..........+++...\n"
+	if got := dump(rt.VPU, 0, 0, 16, 2); got != want {
+		t.Errorf("got\n%swant\n%s", got, want)
+	}
+}
+
+func TestGetColorByIndex(t *testing.T) {
+	rt, mod := newTestRuntime(t)
+	mod.Memory().WriteUint16Le(MemDrawColors, 0x4321)
+
+	for index, want := range []byte{1, 2, 3, 4} {
+		if got := rt.GetColorByIndex(index); got != want {
+			t.Errorf("draw color %d is %d, want %d", index, got, want)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package runtime
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/christopher-kleine/w4g/pkg/wasm"
+)
+
+// MaxCartSize is the largest cart WASM-4 accepts.
+const MaxCartSize = 64 * 1024
+
+// Severity tells whether a Diagnostic stops a cart from loading.
+type Severity int
+
+const (
+	Warning Severity = iota
+	Error
+)
+
+func (s Severity) String() string {
+	if s == Error {
+		return "error"
+	}
+
+	return "warning"
+}
+
+// Diagnostic is a single problem Validate found in a cart.
+type Diagnostic struct {
+	Severity Severity
+	Message  string
+}
+
+func (d Diagnostic) String() string {
+	return d.Severity.String() + ": " + d.Message
+}
+
+// Diagnostics are the findings of Validate. LoadCart returns them as error
+// if any of them is an Error.
+type Diagnostics []Diagnostic
+
+func (d Diagnostics) Error() string {
+	messages := make([]string, len(d))
+	for i, diag := range d {
+		messages[i] = diag.String()
+	}
+
+	return "invalid cart: " + strings.Join(messages, "; ")
+}
+
+// Failed reports whether any of the diagnostics is an Error.
+func (d Diagnostics) Failed() bool {
+	for _, diag := range d {
+		if diag.Severity == Error {
+			return true
+		}
+	}
+
+	return false
+}
+
+// wrap adds the error of wazero to the warnings, which likely explain it.
+func (d Diagnostics) wrap(err error) error {
+	if len(d) == 0 {
+		return err
+	}
+
+	return append(d, Diagnostic{Severity: Error, Message: err.Error()})
+}
+
+func (d *Diagnostics) add(severity Severity, format string, args ...interface{}) {
+	*d = append(*d, Diagnostic{
+		Severity: severity,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// wasiModules are the modules WASI functions are imported from.
+var wasiModules = []string{"wasi_snapshot_preview1", "wasi_unstable"}
+
+// Validate checks a cart against the limits of the WASM-4 platform: its
+// size, the imports the platform provides and the exports it calls.
+func Validate(code []byte) Diagnostics {
+	var diags Diagnostics
+
+	m, err := wasm.Parse(code)
+	if err != nil {
+		diags.add(Error, "not a valid WebAssembly binary: %v", err)
+		return diags
+	}
+
+	validateSize(&diags, m, len(code))
+	validateImports(&diags, m)
+	validateExports(&diags, m)
+	validateStack(&diags, m)
+
+	return diags
+}
+
+func validateSize(diags *Diagnostics, m *wasm.Module, size int) {
+	if size <= MaxCartSize {
+		return
+	}
+
+	custom := 0
+	for _, section := range m.Sections {
+		if section.ID == wasm.SectionCustom {
+			custom += len(section.Data)
+		}
+	}
+
+	// Debug builds are fine as long as the release fits
+	if size-custom <= MaxCartSize {
+		diags.add(Warning, "cart is %d bytes, more than the %d bytes WASM-4 allows, but %d of them are custom sections like debug info that a release build can strip", size, MaxCartSize, custom)
+		return
+	}
+
+	diags.add(Error, "cart is %d bytes, WASM-4 allows at most %d", size, MaxCartSize)
+}
+
+func validateImports(diags *Diagnostics, m *wasm.Module) {
+	env := envFunctions()
+
+	memories := 0
+	for _, imp := range m.Imports {
+		name := imp.Module + "." + imp.Name
+
+		switch {
+		case isWasi(imp.Module):
+			diags.add(Warning, "WASI import %s is not available on WASM-4", name)
+
+		case imp.Module != "env":
+			diags.add(Error, "unknown import %s, WASM-4 only provides the module env", name)
+
+		case imp.Name == "memory":
+			if imp.Type != wasm.ExternMemory {
+				diags.add(Error, "env.memory must be imported as memory, not as %s", imp.Type)
+				continue
+			}
+
+			memories++
+			if imp.Memory.Min != 1 {
+				diags.add(Error, "env.memory must be imported with exactly 1 page, not %d", imp.Memory.Min)
+			}
+
+		default:
+			want, ok := env[imp.Name]
+			if !ok || imp.Type != wasm.ExternFunc {
+				diags.add(Error, "unknown import %s", name)
+				continue
+			}
+
+			if imp.Func >= uint32(len(m.Types)) || !m.Types[imp.Func].Equal(want) {
+				got := "an invalid type"
+				if imp.Func < uint32(len(m.Types)) {
+					got = m.Types[imp.Func].String()
+				}
+				diags.add(Error, "import %s has the signature %s, expected %s", name, got, want)
+			}
+		}
+	}
+
+	if len(m.Memories) > 0 {
+		diags.add(Error, "cart defines its own memory, it has to import env.memory instead")
+	} else if memories == 0 {
+		diags.add(Error, "cart doesn't import env.memory")
+	}
+}
+
+func validateExports(diags *Diagnostics, m *wasm.Module) {
+	exports := map[string]wasm.Export{}
+	for _, exp := range m.Exports {
+		exports[exp.Name] = exp
+	}
+
+	for _, name := range []string{"update", "start"} {
+		exp, ok := exports[name]
+		if !ok {
+			if name == "update" {
+				diags.add(Error, "cart doesn't export update")
+			}
+			continue
+		}
+
+		if exp.Type != wasm.ExternFunc {
+			diags.add(Error, "export %s must be a function, not a %s", name, exp.Type)
+			continue
+		}
+
+		got, ok := m.FuncType(exp.Index)
+		if !ok || len(got.Params) > 0 || len(got.Results) > 0 {
+			diags.add(Error, "export %s has the signature %s, expected () -> ()", name, got)
+		}
+	}
+}
+
+// validateStack warns if the stack of the cart would grow into the reserved
+// memory below MemUser. Compilers keep the stack pointer in a global, named
+// __stack_pointer if the cart has debug info. Without, LLVM based compilers
+// still make it the first global, with a 16 byte aligned initial value. The
+// stack grows down from there.
+func validateStack(diags *Diagnostics, m *wasm.Module) {
+	base := m.ImportedGlobals()
+	names := m.GlobalNames()
+
+	var pointer int32
+	found := false
+	for i, global := range m.Globals {
+		if names[base+uint32(i)] == "__stack_pointer" {
+			pointer, found = global.I32()
+			break
+		}
+	}
+
+	if !found && len(names) == 0 && len(m.Globals) > 0 && m.Globals[0].Mutable {
+		pointer, found = m.Globals[0].I32()
+		found = found && pointer%16 == 0
+	}
+
+	if !found || pointer <= 0 {
+		return
+	}
+
+	if uint32(pointer) <= MemUser {
+		diags.add(Warning, "stack starts at %#x and grows into the reserved memory below %#x, link with --stack-first and --global-base=%d", pointer, MemUser, MemUser)
+	}
+}
+
+func isWasi(module string) bool {
+	for _, wasi := range wasiModules {
+		if module == wasi {
+			return true
+		}
+	}
+
+	return false
+}
+
+// envFunctions returns the functions WASM-4 provides by their name, read
+// from the env module the runtime instantiates.
+func envFunctions() map[string]wasm.FuncType {
+	m, err := wasm.Parse(envWasm)
+	if err != nil {
+		panic(err)
+	}
+
+	functions := map[string]wasm.FuncType{}
+	for _, exp := range m.Exports {
+		if exp.Type != wasm.ExternFunc {
+			continue
+		}
+
+		if t, ok := m.FuncType(exp.Index); ok {
+			functions[exp.Name] = t
+		}
+	}
+
+	return functions
+}
@@ -0,0 +1,89 @@
+package runtime
+
+import (
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/christopher-kleine/w4g/pkg/wasm"
+)
+
+func TestValidate(t *testing.T) {
+	code := readTestCart(t, "hang")
+
+	diags := Validate(code)
+	if len(diags) > 0 {
+		t.Errorf("hang.wasm: unexpected diagnostics %v", diags)
+	}
+
+	code = readTestCart(t, "invalid")
+
+	want := Diagnostics{
+		{Warning, "WASI import wasi_snapshot_preview1.fd_write is not available on WASM-4"},
+		{Error, "import env.rect has the signature (i32, i32, i32) -> (), expected (i32, i32, i32, i32) -> ()"},
+		{Error, "unknown import env.sound"},
+		{Error, "cart defines its own memory, it has to import env.memory instead"},
+		{Error, "cart doesn't export update"},
+		{Error, "export start has the signature (i32) -> (), expected () -> ()"},
+	}
+	diags = Validate(code)
+	if !reflect.DeepEqual(diags, want) {
+		t.Errorf("invalid.wasm: got diagnostics\n%v\nwant\n%v", diags, want)
+	}
+}
+
+func TestValidateSize(t *testing.T) {
+	code := readTestCart(t, "hang")
+
+	// Debug info doesn't count, a release build can strip it
+	debug := append([]byte{5}, "debug"...)
+	debug = append(debug, make([]byte, MaxCartSize)...)
+	diags := Validate(appendSection(code, wasm.SectionCustom, debug))
+	if len(diags) != 1 || diags[0].Severity != Warning {
+		t.Errorf("debug info: got %v, want a single warning", diags)
+	}
+
+	// Function types () -> () of 3 bytes each
+	const count = MaxCartSize / 3
+	types := appendUvarint(nil, count)
+	for i := 0; i < count; i++ {
+		types = append(types, 0x60, 0, 0)
+	}
+	if !Validate(appendSection(code, wasm.SectionType, types)).Failed() {
+		t.Errorf("oversized cart passed validation")
+	}
+}
+
+// appendSection returns a copy of code with another section at the end.
+func appendSection(code []byte, id byte, data []byte) []byte {
+	code = append([]byte{}, code...)
+	code = append(code, id)
+	code = appendUvarint(code, uint64(len(data)))
+
+	return append(code, data...)
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+
+	return append(b, buf[:binary.PutUvarint(buf[:], v)]...)
+}
+
+func TestLoadInvalidCart(t *testing.T) {
+	code := readTestCart(t, "invalid")
+
+	rt, err := NewRuntime()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	rt.Storage = NewMemoryStorage(nil)
+
+	err = rt.LoadCart(code, "invalid.wasm")
+
+	var diags Diagnostics
+	if !errors.As(err, &diags) || !diags.Failed() {
+		t.Fatalf("got %v, want diagnostics", err)
+	}
+}
@@ -2,11 +2,9 @@ package runtime
 
 import (
 	"bytes"
-	"image/color"
 	"math"
 
 	"github.com/christopher-kleine/w4g/pkg/tools"
-	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/tetratelabs/wazero/api"
 )
 
@@ -41,17 +39,36 @@ const (
 	SizeUser         uint32 = 58976
 )
 
+// VPU draws into the framebuffer of a cart.
+//
+// It works on views of the framebuffer and draw colors instead of going
+// through api.Memory for every pixel. The memory of a WASM-4 cart is a single
+// page that never grows, so the views stay valid for the life of the cart.
 type VPU struct {
-	Memory func() api.Memory
+	framebuffer []byte
+	drawColors  []byte
+	palette     []byte
+}
+
+// NewVPU creates a VPU on the memory of a cart.
+func NewVPU(mem api.Memory) *VPU {
+	framebuffer, _ := mem.Read(MemFramebuffer, SizeFramebuffer)
+	drawColors, _ := mem.Read(MemDrawColors, SizeDrawColors)
+	palette, _ := mem.Read(MemPalette, SizePalette)
+
+	return &VPU{
+		framebuffer: framebuffer,
+		drawColors:  drawColors,
+		palette:     palette,
+	}
 }
 
 // This file implements direct access to the framebuffer.
 // Other Drawing functions may use them.
 
 func (vpu *VPU) Init() {
-	colors, _ := vpu.Memory().Read(MemPalette, 16)
-	if bytes.Equal(colors, []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}) {
-		vpu.Memory().Write(MemPalette, []byte{
+	if bytes.Equal(vpu.palette, make([]byte, SizePalette)) {
+		copy(vpu.palette, []byte{
 			0xcf, 0xf8, 0xe0, 0xff,
 			0x6c, 0xc0, 0x86, 0xff,
 			0x50, 0x68, 0x30, 0xff,
@@ -61,63 +78,14 @@ func (vpu *VPU) Init() {
 }
 
 func (vpu *VPU) Clear() {
-	for pos := MemFramebuffer; pos < MemFramebuffer+SizeFramebuffer; pos++ {
-		vpu.Memory().WriteByte(pos, 0)
-	}
-}
-
-func (vpu *VPU) Render(screen *ebiten.Image) {
-	palette, _ := vpu.Memory().Read(MemPalette, SizePalette)
-	colors := []color.Color{
-		color.RGBA{
-			A: 0xff,
-			R: palette[2],
-			G: palette[1],
-			B: palette[0],
-		},
-		color.RGBA{
-			A: 0xff,
-			R: palette[2+4],
-			G: palette[1+4],
-			B: palette[0+4],
-		},
-		color.RGBA{
-			A: 0xff,
-			R: palette[2+8],
-			G: palette[1+8],
-			B: palette[0+8],
-		},
-		color.RGBA{
-			A: 0xff,
-			R: palette[2+12],
-			G: palette[1+12],
-			B: palette[0+12],
-		},
-	}
-
-	framebuffer, _ := vpu.Memory().Read(MemFramebuffer, SizeFramebuffer)
-	for offY, pixel := range framebuffer {
-		colorIndex := []byte{
-			pixel & 3,
-			(pixel >> 2) & 3,
-			(pixel >> 4) & 3,
-			(pixel >> 6) & 3,
-		}
-
-		x := (offY * 4) % WIDTH
-		y := (offY * 4) / WIDTH
-
-		for offX, index := range colorIndex {
-			screen.Set(int(x)+offX, int(y), colors[index])
-		}
+	for i := range vpu.framebuffer {
+		vpu.framebuffer[i] = 0
 	}
 }
 
 func (vpu *VPU) Blit(sprite []byte, dstX, dstY, w, h, srcX, srcY, stride int32, bpp2, flipX, flipY, rotate bool) {
-	drawColors, _ := vpu.Memory().Read(MemDrawColors, SizeDrawColors)
-
 	var (
-		colors             uint16 = uint16(drawColors[0]) | (uint16(drawColors[1]) << 8)
+		colors             uint16 = uint16(vpu.drawColors[0]) | (uint16(vpu.drawColors[1]) << 8)
 		clipXMin, clipYMin int32
 		clipXMax, clipYMax int32
 		tx, ty             int32
@@ -227,13 +195,31 @@ func (vpu *VPU) unclippedHLine(color byte, startX, y, endX int32) {
 		}
 
 		if startX < endX {
-			for x := startX; x < endX; x++ {
-				vpu.unclippedPoint(color, x, y)
-			}
+			vpu.span(color, startX, endX, y)
 		}
 	}
 }
 
+// span fills the pixels from startX up to endX of row y. The range must be
+// within the framebuffer. Whole bytes are written at once, only the pixels
+// at both ends that share a byte with their neighbours are set one by one.
+func (vpu *VPU) span(color byte, startX, endX, y int32) {
+	for startX < endX && startX&0x3 != 0 {
+		vpu.point(color, startX, y)
+		startX++
+	}
+	for endX > startX && endX&0x3 != 0 {
+		endX--
+		vpu.point(color, endX, y)
+	}
+
+	row := y * WIDTH >> 2
+	fill := color * 0x55
+	for idx := row + startX>>2; idx < row+endX>>2; idx++ {
+		vpu.framebuffer[idx] = fill
+	}
+}
+
 func (vpu *VPU) VLine(color byte, x, y, len int32) {
 	if y+len <= 0 || x < 0 || x >= WIDTH || color == 0 {
 		return
@@ -248,14 +234,9 @@ func (vpu *VPU) VLine(color byte, x, y, len int32) {
 }
 
 func (vpu *VPU) point(color byte, x, y int32) {
-	var (
-		idx             int32 = (y*HEIGHT + x) >> 2
-		currentValue, _       = vpu.Memory().ReadByte(uint32(idx) + MemFramebuffer)
-		shift           int32 = (x & 0x3) << 1
-		mask            int32 = 0x3 << shift
-		value           uint8 = uint8((int32(color) << shift) | (int32(currentValue) & ^mask))
-	)
-	vpu.Memory().WriteByte(uint32(idx)+MemFramebuffer, value)
+	idx := (y*WIDTH + x) >> 2
+	shift := (x & 0x3) << 1
+	vpu.framebuffer[idx] = vpu.framebuffer[idx]&^(0x3<<shift) | color<<shift
 }
 
 func (vpu *VPU) unclippedPoint(colorIndex byte, x, y int32) {
@@ -272,17 +253,20 @@ func (vpu *VPU) Text(txt []byte, x, y int32) {
 	currX := x
 	currY := y
 	for _, letter := range txt {
-		l := int32(letter)
-		switch letter {
-		case 0:
+		switch {
+		case letter == 0:
 			return
 
-		case '\n':
+		case letter == '\n':
 			currX = x
 			currY += 8
 
+		case letter < fontFirst:
+			// Other control characters leave an empty cell
+			currX += 8
+
 		default:
-			vpu.Blit(font, currX, currY, 8, 8, 0, (l-32)<<3, 8, false, false, false, false)
+			vpu.Blit(font, currX, currY, 8, 8, 0, int32(letter-fontFirst)<<3, 8, false, false, false, false)
 			currX += 8
 		}
 	}
@@ -302,7 +286,6 @@ func (vpu *VPU) Oval(x, y, width, height int32, fillColor, strokeColor byte) {
 	b := height - 1
 	b1 := b % 2
 
-	// north := y + int32(math.Floor(float64(height)/2))
 	north := y + height/2
 	west := x
 	east := x + width - 1
@@ -316,8 +299,6 @@ func (vpu *VPU) Oval(x, y, width, height int32, fillColor, strokeColor byte) {
 	a *= 8 * a
 	b1 = 8 * b * b
 
-	// fmt.Print("OvalFB: ", x, ", ", y, ", ", width, ", ", height, ", ", strokeColor, ", ", fillColor, ", ", north, ", ", west, ", ", east, ", ", south, ", ", dx, ", ", dy, ", ", err, ", ", a, ", ", b1, "\n")
-
 	var err2 int32
 
 	for {
@@ -373,14 +354,11 @@ func (vpu *VPU) Rect(x, y, width, height int32, fillColor, strokeColor byte) {
 	endX := tools.Min(WIDTH, endXUnclamp)
 	endY := tools.Min(HEIGHT, endYUnclamp)
 
-	// dc0 := vpu.GetColorByIndex(0)
-	// dc1 := vpu.GetColorByIndex(1)
-
 	if fillColor != 0 {
 		fillColor = (fillColor - 1) & 0x3
-		for yy := startY; yy < endY; yy++ {
-			for xx := startX; xx < endX; xx++ {
-				vpu.point(fillColor, xx, yy)
+		if startX < endX {
+			for yy := startY; yy < endY; yy++ {
+				vpu.span(fillColor, startX, endX, yy)
 			}
 		}
 	}
@@ -403,17 +381,13 @@ func (vpu *VPU) Rect(x, y, width, height int32, fillColor, strokeColor byte) {
 		}
 
 		// Top edge
-		if y >= 0 && y < HEIGHT {
-			for xx := startX; xx < endX; xx++ {
-				vpu.point(strokeColor, xx, y)
-			}
+		if y >= 0 && y < HEIGHT && startX < endX {
+			vpu.span(strokeColor, startX, endX, y)
 		}
 
 		// Bottom edge
-		if endYUnclamp > 0 && endYUnclamp <= HEIGHT {
-			for xx := startX; xx < endX; xx++ {
-				vpu.point(strokeColor, xx, endYUnclamp-1)
-			}
+		if endYUnclamp > 0 && endYUnclamp <= HEIGHT && startX < endX {
+			vpu.span(strokeColor, startX, endX, endYUnclamp-1)
 		}
 	}
 }
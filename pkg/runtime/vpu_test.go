@@ -0,0 +1,306 @@
+package runtime
+
+import (
+	"context"
+	"encoding/binary"
+	"image/color"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+)
+
+// memoryModule is a WebAssembly module that only exports a single page of
+// memory.
+var memoryModule = []byte{
+	0x00, 'a', 's', 'm', 0x01, 0x00, 0x00, 0x00,
+	0x05, 0x03, 0x01, 0x00, 0x01,
+	0x07, 0x0a, 0x01, 0x06, 'm', 'e', 'm', 'o', 'r', 'y', 0x02, 0x00,
+}
+
+// newTestVPU creates a VPU on a blank memory with the default palette.
+func newTestVPU(t testing.TB) *VPU {
+	t.Helper()
+
+	ctx := context.Background()
+	r := wazero.NewRuntime(ctx)
+	t.Cleanup(func() { r.Close(ctx) })
+
+	mod, err := r.Instantiate(ctx, memoryModule)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vpu := NewVPU(mod.Memory())
+	vpu.Init()
+
+	return vpu
+}
+
+func setDrawColors(vpu *VPU, colors uint16) {
+	binary.LittleEndian.PutUint16(vpu.drawColors, colors)
+}
+
+// dump returns the given area of the framebuffer with one character per
+// pixel, '.' for color 0 up to '#' for color 3.
+func dump(vpu *VPU, x, y, w, h int) string {
+
+	var b strings.Builder
+	for row := y; row < y+h; row++ {
+		for col := x; col < x+w; col++ {
+			idx := row*WIDTH + col
+			b.WriteByte(".-+#"[(vpu.framebuffer[idx/4]>>((idx%4)*2))&0x3])
+		}
+		b.WriteByte('\n')
+	}
+
+	return b.String()
+}
+
+// sprite1bpp is an asymmetric 8x8 sprite, so flips and rotations show.
+var sprite1bpp = []byte{
+	0b11111111,
+	0b10000000,
+	0b10000000,
+	0b11111000,
+	0b10000000,
+	0b10000000,
+	0b10000000,
+	0b00000001,
+}
+
+// sprite2bpp is an 8x4 sprite using all four colors.
+var sprite2bpp = []byte{
+	0b00011011, 0b00000000,
+	0b01010101, 0b11111111,
+	0b10101010, 0b00011011,
+	0b11100100, 0b11111111,
+}
+
+// atlas1bpp holds two 8x8 sprites next to each other, the second one being
+// sprite1bpp.
+var atlas1bpp = []byte{
+	0b00000000, 0b11111111,
+	0b01111110, 0b10000000,
+	0b01000010, 0b10000000,
+	0b01000010, 0b11111000,
+	0b01000010, 0b10000000,
+	0b01000010, 0b10000000,
+	0b01111110, 0b10000000,
+	0b00000000, 0b00000001,
+}
+
+type region struct {
+	x, y, w, h int
+}
+
+// vpuTests draw on a cleared framebuffer and compare a region of it with
+// testdata/vpu/<name>.golden. The golden files were written by this VPU with
+// -update, they aren't captured from the official WASM-4 runtime. When one
+// needs to change, compare the drawing with the official runtime first.
+var vpuTests = []struct {
+	name   string
+	colors uint16
+	draw   func(vpu *VPU)
+	region region
+}{
+	// Blit
+	{"blit_1bpp", 0x0041, func(vpu *VPU) { vpu.Blit(sprite1bpp, 2, 2, 8, 8, 0, 0, 8, false, false, false, false) }, region{0, 0, 12, 12}},
+	{"blit_1bpp_transparent_background", 0x0040, func(vpu *VPU) {
+		vpu.Rect(0, 0, 12, 12, 2, 0)
+		vpu.Blit(sprite1bpp, 2, 2, 8, 8, 0, 0, 8, false, false, false, false)
+	}, region{0, 0, 12, 12}},
+	{"blit_1bpp_transparent_foreground", 0x0003, func(vpu *VPU) {
+		vpu.Rect(0, 0, 12, 12, 2, 0)
+		vpu.Blit(sprite1bpp, 2, 2, 8, 8, 0, 0, 8, false, false, false, false)
+	}, region{0, 0, 12, 12}},
+	{"blit_1bpp_flip_x", 0x0041, func(vpu *VPU) { vpu.Blit(sprite1bpp, 2, 2, 8, 8, 0, 0, 8, false, true, false, false) }, region{0, 0, 12, 12}},
+	{"blit_1bpp_flip_y", 0x0041, func(vpu *VPU) { vpu.Blit(sprite1bpp, 2, 2, 8, 8, 0, 0, 8, false, false, true, false) }, region{0, 0, 12, 12}},
+	{"blit_1bpp_flip_xy", 0x0041, func(vpu *VPU) { vpu.Blit(sprite1bpp, 2, 2, 8, 8, 0, 0, 8, false, true, true, false) }, region{0, 0, 12, 12}},
+	{"blit_1bpp_rotate", 0x0041, func(vpu *VPU) { vpu.Blit(sprite1bpp, 2, 2, 8, 8, 0, 0, 8, false, false, false, true) }, region{0, 0, 12, 12}},
+	{"blit_1bpp_rotate_flip_x", 0x0041, func(vpu *VPU) { vpu.Blit(sprite1bpp, 2, 2, 8, 8, 0, 0, 8, false, true, false, true) }, region{0, 0, 12, 12}},
+	{"blit_1bpp_rotate_flip_y", 0x0041, func(vpu *VPU) { vpu.Blit(sprite1bpp, 2, 2, 8, 8, 0, 0, 8, false, false, true, true) }, region{0, 0, 12, 12}},
+	{"blit_1bpp_clip_left", 0x0041, func(vpu *VPU) { vpu.Blit(sprite1bpp, -3, 2, 8, 8, 0, 0, 8, false, false, false, false) }, region{0, 0, 8, 12}},
+	{"blit_1bpp_clip_right", 0x0041, func(vpu *VPU) { vpu.Blit(sprite1bpp, WIDTH-5, 2, 8, 8, 0, 0, 8, false, false, false, false) }, region{WIDTH - 8, 0, 8, 12}},
+	{"blit_1bpp_clip_top", 0x0041, func(vpu *VPU) { vpu.Blit(sprite1bpp, 2, -3, 8, 8, 0, 0, 8, false, false, false, false) }, region{0, 0, 12, 8}},
+	{"blit_1bpp_clip_bottom", 0x0041, func(vpu *VPU) { vpu.Blit(sprite1bpp, 2, HEIGHT-5, 8, 8, 0, 0, 8, false, false, false, false) }, region{0, HEIGHT - 8, 12, 8}},
+	{"blit_1bpp_clip_corner_rotate", 0x0041, func(vpu *VPU) { vpu.Blit(sprite1bpp, WIDTH-5, HEIGHT-3, 8, 8, 0, 0, 8, false, false, false, true) }, region{WIDTH - 8, HEIGHT - 8, 8, 8}},
+	{"blit_1bpp_offscreen", 0x0041, func(vpu *VPU) { vpu.Blit(sprite1bpp, -8, HEIGHT, 8, 8, 0, 0, 8, false, false, false, false) }, region{0, 0, WIDTH, HEIGHT}},
+	{"blit_2bpp", 0x4321, func(vpu *VPU) { vpu.Blit(sprite2bpp, 2, 2, 8, 4, 0, 0, 8, true, false, false, false) }, region{0, 0, 12, 8}},
+	{"blit_2bpp_transparent", 0x4320, func(vpu *VPU) {
+		vpu.Rect(0, 0, 12, 8, 2, 0)
+		vpu.Blit(sprite2bpp, 2, 2, 8, 4, 0, 0, 8, true, false, false, false)
+	}, region{0, 0, 12, 8}},
+	{"blit_2bpp_flip_xy", 0x4321, func(vpu *VPU) { vpu.Blit(sprite2bpp, 2, 2, 8, 4, 0, 0, 8, true, true, true, false) }, region{0, 0, 12, 8}},
+	{"blit_2bpp_rotate", 0x4321, func(vpu *VPU) { vpu.Blit(sprite2bpp, 2, 2, 8, 4, 0, 0, 8, true, false, false, true) }, region{0, 0, 8, 12}},
+	{"blit_2bpp_clip_left", 0x4321, func(vpu *VPU) { vpu.Blit(sprite2bpp, -3, 2, 8, 4, 0, 0, 8, true, false, false, false) }, region{0, 0, 8, 8}},
+	{"blit_sub_1bpp", 0x0041, func(vpu *VPU) { vpu.Blit(atlas1bpp, 2, 2, 8, 8, 8, 0, 16, false, false, false, false) }, region{0, 0, 12, 12}},
+	{"blit_sub_1bpp_part", 0x0041, func(vpu *VPU) { vpu.Blit(atlas1bpp, 2, 2, 6, 4, 5, 2, 16, false, false, false, false) }, region{0, 0, 12, 8}},
+	{"blit_sub_1bpp_flip_x", 0x0041, func(vpu *VPU) { vpu.Blit(atlas1bpp, 2, 2, 8, 8, 8, 0, 16, false, true, false, false) }, region{0, 0, 12, 12}},
+
+	// Line
+	{"line_diagonal", 0x0004, func(vpu *VPU) { vpu.Line(4, 1, 1, 10, 6) }, region{0, 0, 12, 8}},
+	{"line_steep", 0x0004, func(vpu *VPU) { vpu.Line(4, 2, 10, 5, 1) }, region{0, 0, 8, 12}},
+	{"line_horizontal_reversed", 0x0004, func(vpu *VPU) { vpu.Line(4, 9, 2, 1, 2) }, region{0, 0, 12, 4}},
+	{"line_clip_top_left", 0x0004, func(vpu *VPU) { vpu.Line(4, -5, -3, 6, 8) }, region{0, 0, 10, 10}},
+	{"line_clip_bottom_right", 0x0004, func(vpu *VPU) { vpu.Line(4, WIDTH-4, HEIGHT-6, WIDTH+3, HEIGHT+2) }, region{WIDTH - 8, HEIGHT - 8, 8, 8}},
+	{"line_transparent", 0x0000, func(vpu *VPU) { vpu.Line(0, 1, 1, 10, 6) }, region{0, 0, 12, 8}},
+
+	// HLine and VLine
+	{"hline", 0x0003, func(vpu *VPU) { vpu.HLine(3, 2, 1, 6) }, region{0, 0, 10, 3}},
+	{"hline_clip_left", 0x0003, func(vpu *VPU) { vpu.HLine(3, -4, 1, 6) }, region{0, 0, 10, 3}},
+	{"hline_clip_right", 0x0003, func(vpu *VPU) { vpu.HLine(3, WIDTH-3, 1, 6) }, region{WIDTH - 10, 0, 10, 3}},
+	{"hline_offscreen", 0x0003, func(vpu *VPU) { vpu.HLine(3, 0, -1, 6); vpu.HLine(3, 0, HEIGHT, 6) }, region{0, 0, WIDTH, HEIGHT}},
+	{"hline_transparent", 0x0000, func(vpu *VPU) { vpu.HLine(0, 2, 1, 6) }, region{0, 0, 10, 3}},
+	{"vline", 0x0002, func(vpu *VPU) { vpu.VLine(2, 1, 2, 6) }, region{0, 0, 3, 10}},
+	{"vline_clip_top", 0x0002, func(vpu *VPU) { vpu.VLine(2, 1, -4, 6) }, region{0, 0, 3, 10}},
+	{"vline_clip_bottom", 0x0002, func(vpu *VPU) { vpu.VLine(2, 1, HEIGHT-3, 6) }, region{0, HEIGHT - 10, 3, 10}},
+	{"vline_offscreen", 0x0002, func(vpu *VPU) { vpu.VLine(2, -1, 0, 6); vpu.VLine(2, WIDTH, 0, 6) }, region{0, 0, WIDTH, HEIGHT}},
+
+	// Oval
+	{"oval_circle", 0x0042, func(vpu *VPU) { vpu.Oval(1, 1, 8, 8, 2, 4) }, region{0, 0, 10, 10}},
+	{"oval_odd", 0x0042, func(vpu *VPU) { vpu.Oval(1, 1, 9, 5, 2, 4) }, region{0, 0, 11, 7}},
+	{"oval_tall", 0x0042, func(vpu *VPU) { vpu.Oval(1, 1, 4, 10, 2, 4) }, region{0, 0, 6, 12}},
+	{"oval_no_fill", 0x0040, func(vpu *VPU) { vpu.Oval(1, 1, 8, 8, 0, 4) }, region{0, 0, 10, 10}},
+	{"oval_clip_left", 0x0042, func(vpu *VPU) { vpu.Oval(-4, 1, 8, 8, 2, 4) }, region{0, 0, 10, 10}},
+	{"oval_clip_right", 0x0042, func(vpu *VPU) { vpu.Oval(WIDTH-4, 1, 8, 8, 2, 4) }, region{WIDTH - 10, 0, 10, 10}},
+	{"oval_clip_top", 0x0042, func(vpu *VPU) { vpu.Oval(1, -4, 8, 8, 2, 4) }, region{0, 0, 10, 10}},
+	{"oval_clip_bottom", 0x0042, func(vpu *VPU) { vpu.Oval(1, HEIGHT-4, 8, 8, 2, 4) }, region{0, HEIGHT - 10, 10, 10}},
+
+	// Rect
+	{"rect", 0x0042, func(vpu *VPU) { vpu.Rect(1, 1, 8, 5, 2, 4) }, region{0, 0, 10, 7}},
+	{"rect_no_stroke", 0x0002, func(vpu *VPU) { vpu.Rect(1, 1, 8, 5, 2, 0) }, region{0, 0, 10, 7}},
+	{"rect_no_fill", 0x0040, func(vpu *VPU) { vpu.Rect(1, 1, 8, 5, 0, 4) }, region{0, 0, 10, 7}},
+	{"rect_clip_left", 0x0042, func(vpu *VPU) { vpu.Rect(-3, 1, 8, 5, 2, 4) }, region{0, 0, 10, 7}},
+	{"rect_clip_right", 0x0042, func(vpu *VPU) { vpu.Rect(WIDTH-5, 1, 8, 5, 2, 4) }, region{WIDTH - 10, 0, 10, 7}},
+	{"rect_clip_top", 0x0042, func(vpu *VPU) { vpu.Rect(1, -3, 8, 5, 2, 4) }, region{0, 0, 10, 7}},
+	{"rect_clip_bottom", 0x0042, func(vpu *VPU) { vpu.Rect(1, HEIGHT-3, 8, 5, 2, 4) }, region{0, HEIGHT - 7, 10, 7}},
+	{"rect_fullscreen", 0x0042, func(vpu *VPU) { vpu.Rect(-1, -1, WIDTH+2, HEIGHT+2, 2, 4) }, region{0, 0, WIDTH, HEIGHT}},
+
+	// Text
+	{"text", 0x0004, func(vpu *VPU) { vpu.Text([]byte("Hi!"), 1, 1) }, region{0, 0, 26, 10}},
+	{"text_background", 0x0024, func(vpu *VPU) { vpu.Text([]byte("Hi!"), 1, 1) }, region{0, 0, 26, 10}},
+	{"text_multiline", 0x0004, func(vpu *VPU) { vpu.Text([]byte("a\nbc"), 1, 1) }, region{0, 0, 18, 18}},
+	{"text_clip_left", 0x0004, func(vpu *VPU) { vpu.Text([]byte("W4"), -4, 1) }, region{0, 0, 14, 10}},
+	{"text_clip_bottom_right", 0x0004, func(vpu *VPU) { vpu.Text([]byte("W4"), WIDTH-12, HEIGHT-5) }, region{WIDTH - 14, HEIGHT - 10, 14, 10}},
+}
+
+func TestVPU(t *testing.T) {
+	vpu := newTestVPU(t)
+
+	for _, tt := range vpuTests {
+		t.Run(tt.name, func(t *testing.T) {
+			vpu.Clear()
+			setDrawColors(vpu, tt.colors)
+
+			tt.draw(vpu)
+
+			r := tt.region
+			// These files are references for the VPU, so -update leaves
+			// them alone
+			name := filepath.Join("vpu", tt.name+".golden")
+			compareGolden(t, name, []byte(dump(vpu, r.x, r.y, r.w, r.h)), "see testdata/vpu/README.md")
+		})
+	}
+}
+
+func BenchmarkClear(b *testing.B) {
+	vpu := newTestVPU(b)
+
+	for i := 0; i < b.N; i++ {
+		vpu.Clear()
+	}
+}
+
+func BenchmarkRectFullscreen(b *testing.B) {
+	vpu := newTestVPU(b)
+
+	for i := 0; i < b.N; i++ {
+		vpu.Rect(0, 0, WIDTH, HEIGHT, 2, 3)
+	}
+}
+
+func BenchmarkHLine(b *testing.B) {
+	vpu := newTestVPU(b)
+
+	for i := 0; i < b.N; i++ {
+		vpu.HLine(3, 1, 80, WIDTH-2)
+	}
+}
+
+func BenchmarkOval(b *testing.B) {
+	vpu := newTestVPU(b)
+
+	for i := 0; i < b.N; i++ {
+		vpu.Oval(20, 20, 120, 120, 2, 3)
+	}
+}
+
+func BenchmarkBlit1bpp(b *testing.B) {
+	vpu := newTestVPU(b)
+	setDrawColors(vpu, 0x0041)
+
+	for i := 0; i < b.N; i++ {
+		vpu.Blit(sprite1bpp, 10, 10, 8, 8, 0, 0, 8, false, false, false, false)
+	}
+}
+
+func BenchmarkBlit2bppRotate(b *testing.B) {
+	vpu := newTestVPU(b)
+	setDrawColors(vpu, 0x4321)
+
+	for i := 0; i < b.N; i++ {
+		vpu.Blit(sprite2bpp, 10, 10, 8, 4, 0, 0, 8, true, true, false, true)
+	}
+}
+
+func BenchmarkText(b *testing.B) {
+	vpu := newTestVPU(b)
+	setDrawColors(vpu, 0x0004)
+	text := []byte("The quick brown fox!")
+
+	for i := 0; i < b.N; i++ {
+		vpu.Text(text, 0, 76)
+	}
+}
+
+// BenchmarkFrame draws a busy frame and converts it to RGBA, as the frontend
+// does 60 times a second. It fails if a frame takes 1 ms or more.
+func BenchmarkFrame(b *testing.B) {
+	vpu := newTestVPU(b)
+	palette := [4]color.RGBA{{A: 0xff}, {R: 0xff, A: 0xff}, {G: 0xff, A: 0xff}, {B: 0xff, A: 0xff}}
+	pixels := make([]byte, WIDTH*HEIGHT*4)
+	var converter PixelConverter
+
+	b.ResetTimer()
+	start := time.Now()
+
+	for i := 0; i < b.N; i++ {
+		vpu.Clear()
+
+		setDrawColors(vpu, 0x0002)
+		vpu.Rect(0, 0, WIDTH, 120, 2, 0)
+		setDrawColors(vpu, 0x0043)
+		vpu.Rect(0, 120, WIDTH, 40, 3, 4)
+		vpu.Oval(60, 10, 40, 40, 2, 4)
+		vpu.Line(4, 0, 0, WIDTH-1, HEIGHT-1)
+
+		setDrawColors(vpu, 0x4321)
+		for n := int32(0); n < 100; n++ {
+			vpu.Blit(sprite2bpp, n*37%WIDTH, n*23%HEIGHT, 8, 4, 0, 0, 8, true, n&1 == 1, false, n&2 == 2)
+		}
+
+		setDrawColors(vpu, 0x0004)
+		for line := int32(0); line < 4; line++ {
+			vpu.Text([]byte("SCORE 0001234 HI 99"), 4, 124+line*8)
+		}
+
+		converter.Convert(pixels, vpu.framebuffer, palette)
+	}
+
+	if perFrame := time.Since(start) / time.Duration(b.N); perFrame >= time.Millisecond {
+		b.Errorf("a frame took %v", perFrame)
+	}
+}
@@ -0,0 +1,149 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/sys"
+)
+
+// OverrunPolicy decides what happens to a frame that exceeds the Budget of
+// a Runtime.
+type OverrunPolicy int
+
+const (
+	// OverrunSkip drops the frame. The cart continues with the next one as
+	// if the frame never ran.
+	OverrunSkip OverrunPolicy = iota
+
+	// OverrunPause drops the frame and pauses the cart until Resume is
+	// called.
+	OverrunPause
+
+	// OverrunAbort crashes the cart.
+	OverrunAbort
+)
+
+var overrunPolicies = []string{"skip", "pause", "abort"}
+
+func (p OverrunPolicy) String() string {
+	if p < 0 || int(p) >= len(overrunPolicies) {
+		return fmt.Sprintf("OverrunPolicy(%d)", int(p))
+	}
+
+	return overrunPolicies[p]
+}
+
+// ParseOverrunPolicy parses the name of a policy: skip, pause or abort.
+func ParseOverrunPolicy(name string) (OverrunPolicy, error) {
+	for i, policy := range overrunPolicies {
+		if policy == name {
+			return OverrunPolicy(i), nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown overrun policy %q, use skip, pause or abort", name)
+}
+
+// Overrun is returned by Step for a frame that exceeded the Budget.
+type Overrun struct {
+	Frame  uint64
+	Budget time.Duration
+}
+
+func (o *Overrun) Error() string {
+	return fmt.Sprintf("frame %d took longer than %v", o.Frame, o.Budget)
+}
+
+// Paused returns the Overrun that paused the cart, or nil if it isn't
+// paused.
+func (rt *Runtime) Paused() *Overrun {
+	return rt.paused
+}
+
+// Resume continues a cart paused by OverrunPause. The next Step runs the
+// dropped frame again.
+func (rt *Runtime) Resume() {
+	rt.paused = nil
+}
+
+// call runs an exported function of the cart within the Budget.
+func (rt *Runtime) call(fn api.Function) error {
+	if rt.Budget <= 0 {
+		_, err := fn.Call(rt.ctx)
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(rt.ctx, rt.Budget)
+	defer cancel()
+
+	_, err := fn.Call(ctx)
+
+	return err
+}
+
+// timedOut reports whether wazero closed the cart because a call exceeded
+// the Budget.
+func timedOut(err error) bool {
+	var exit *sys.ExitError
+
+	return errors.As(err, &exit) && exit.ExitCode() == sys.ExitCodeDeadlineExceeded
+}
+
+// instantiate creates a fresh instance of the cart, without running start.
+func (rt *Runtime) instantiate() error {
+	cart, err := instantiate(rt.ctx, rt.runtime, rt.compiled)
+	if err != nil {
+		return err
+	}
+
+	rt.cart = cart
+	rt.VPU = NewVPU(cart.Memory())
+
+	return nil
+}
+
+// instantiate creates an anonymous instance of a compiled cart. Carts are
+// never instantiated under their name, so a reloaded cart can live next to
+// the instance it replaces.
+func instantiate(ctx context.Context, r wazero.Runtime, compiled wazero.CompiledModule) (api.Module, error) {
+	return r.InstantiateModule(ctx, compiled, wazero.NewModuleConfig().WithName(""))
+}
+
+// overrun brings back a cart that was closed for exceeding the Budget. The
+// new instance is restored to before, the state ahead of the frame, and
+// OnOverrun decides how to go on. Without a state, as in start, the cart
+// always crashes.
+func (rt *Runtime) overrun(before *State) error {
+	overrun := &Overrun{Frame: rt.frame, Budget: rt.Budget}
+
+	err := rt.instantiate()
+	if err != nil {
+		return err
+	}
+
+	if before == nil {
+		return rt.crashed(overrun)
+	}
+
+	err = rt.restore(before, false)
+	if err != nil {
+		return err
+	}
+
+	switch rt.OnOverrun {
+	case OverrunSkip:
+		return overrun
+
+	case OverrunPause:
+		rt.paused = overrun
+		return overrun
+
+	default:
+		return rt.crashed(overrun)
+	}
+}
@@ -0,0 +1,121 @@
+package runtime
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// hangNext runs testdata/carts/hang.wasm with policy up to the frame that
+// hangs.
+func hangNext(t *testing.T, policy OverrunPolicy) *Runtime {
+	t.Helper()
+
+	rt := loadTestCart(t, "hang", nil)
+	rt.Budget = 20 * time.Millisecond
+	rt.OnOverrun = policy
+	stepFrames(t, rt, 2)
+
+	return rt
+}
+
+func TestOverrunSkip(t *testing.T) {
+	rt := hangNext(t, OverrunSkip)
+
+	var overrun *Overrun
+	err := rt.Step(InputState{})
+	if !errors.As(err, &overrun) || overrun.Frame != 2 {
+		t.Fatalf("got %v, want an overrun in frame 2", err)
+	}
+	if rt.Frame() != 2 || rt.Paused() != nil || rt.Crash() != nil {
+		t.Errorf("frame %d, paused %v, crash %v after skipping", rt.Frame(), rt.Paused(), rt.Crash())
+	}
+
+	// The frame is skipped with the state from before it, so the cart hangs
+	// again
+	err = rt.Step(InputState{})
+	if !errors.As(err, &overrun) {
+		t.Errorf("got %v, want another overrun", err)
+	}
+}
+
+func TestOverrunPause(t *testing.T) {
+	rt := hangNext(t, OverrunPause)
+
+	err := rt.Step(InputState{})
+	if rt.Paused() == nil {
+		t.Fatalf("not paused after %v", err)
+	}
+
+	// A paused cart doesn't run
+	start := time.Now()
+	err = rt.Step(InputState{})
+	if err != rt.Paused() || time.Since(start) >= rt.Budget {
+		t.Errorf("paused cart ran, got %v", err)
+	}
+
+	rt.Resume()
+	if rt.Paused() != nil {
+		t.Error("still paused after Resume")
+	}
+}
+
+func TestOverrunAbort(t *testing.T) {
+	rt := hangNext(t, OverrunAbort)
+	before := rt.Snapshot(nil)
+
+	// Crashing needs no state from before the frame
+	if rt.before != nil {
+		t.Error("snapshot taken ahead of frames that can only crash")
+	}
+
+	var crash *Crash
+	var overrun *Overrun
+	err := rt.Step(InputState{})
+	if !errors.As(err, &crash) || !errors.As(err, &overrun) {
+		t.Fatalf("got %v, want a crash caused by an overrun", err)
+	}
+
+	// The cart runs again once a state is restored
+	err = rt.Restore(before)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rt.Crash() != nil {
+		t.Error("still crashed after Restore")
+	}
+}
+
+func TestOverrunInHack(t *testing.T) {
+	code := readTestCart(t, "hangload")
+
+	rt, err := NewRuntime()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	rt.Storage = NewMemoryStorage(nil)
+	rt.Budget = 20 * time.Millisecond
+
+	var crash *Crash
+	var overrun *Overrun
+	err = rt.LoadCart(code, "hangload.wasm")
+	if !errors.As(err, &crash) || !errors.As(err, &overrun) {
+		t.Fatalf("got %v, want a crash caused by an overrun", err)
+	}
+}
+
+func TestParseOverrunPolicy(t *testing.T) {
+	for _, policy := range []OverrunPolicy{OverrunSkip, OverrunPause, OverrunAbort} {
+		got, err := ParseOverrunPolicy(policy.String())
+		if err != nil || got != policy {
+			t.Errorf("parsing %s returned %v, %v", policy, got, err)
+		}
+	}
+
+	_, err := ParseOverrunPolicy("ignore")
+	if err == nil {
+		t.Error("unknown policy parsed")
+	}
+}
@@ -0,0 +1,371 @@
+// Package script runs carts headlessly following a test script. A script is
+// a text file with one command per line:
+//
+//	# Comments and empty lines are ignored
+//	input 1 right x      hold buttons of a gamepad (1-4), x z left right up down
+//	input 1              release all buttons of gamepad 1
+//	mouse 80 60 left     move the mouse and hold left, right or middle
+//	wait 30              run 30 frames (1 if omitted)
+//	hash 5f2c9a01        assert the SHA-256 of the framebuffer, or a prefix of it
+//	pixel 10 20 3        assert the palette index of a pixel
+//	mem 0x3000 u16 42    assert a value in memory (u8, u16 or u32)
+//	trace Hello          assert a traced message since the last trace assertion
+//
+// Numbers are decimal, or hexadecimal with a 0x prefix. Assertions don't stop
+// the script, all failures are reported at the end.
+package script
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/christopher-kleine/w4g/pkg/runtime"
+)
+
+var buttons = map[string]byte{
+	"x":     runtime.PadX,
+	"z":     runtime.PadY,
+	"left":  runtime.PadLeft,
+	"right": runtime.PadRight,
+	"up":    runtime.PadUp,
+	"down":  runtime.PadDown,
+}
+
+var mouseButtons = map[string]byte{
+	"left":   runtime.MouseLeft,
+	"right":  runtime.MouseRight,
+	"middle": runtime.MouseMiddle,
+}
+
+// DefaultBudget is the time a frame may take before Run gives up on the
+// cart.
+const DefaultBudget = time.Second
+
+type Script struct {
+	Name string
+
+	// Budget limits the time of every frame, a cart that exceeds it fails
+	// the run.
+	Budget time.Duration
+
+	steps []step
+}
+
+type step struct {
+	line int
+	run  func(t *test) error
+}
+
+// test is the state of a single run of a script.
+type test struct {
+	name     string
+	line     int
+	rt       *runtime.Runtime
+	input    runtime.InputState
+	traces   []string
+	frame    int
+	failures Failures
+}
+
+// Failures lists every failed assertion of a run.
+type Failures []string
+
+func (f Failures) Error() string {
+	return strings.Join(f, "\n")
+}
+
+// Parse reads a script. name is used in error messages.
+func Parse(r io.Reader, name string) (*Script, error) {
+	s := &Script{Name: name, Budget: DefaultBudget}
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		run, err := parseCommand(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, line, err)
+		}
+
+		s.steps = append(s.steps, step{line: line, run: run})
+	}
+
+	return s, scanner.Err()
+}
+
+func parseCommand(text string) (func(t *test) error, error) {
+	fields := strings.Fields(text)
+	cmd, args := fields[0], fields[1:]
+
+	switch cmd {
+	case "input":
+		if len(args) == 0 {
+			return nil, fmt.Errorf("input needs a gamepad")
+		}
+		pad, err := parseInt(args[0], 1, 4)
+		if err != nil {
+			return nil, err
+		}
+		var held byte
+		for _, arg := range args[1:] {
+			button, ok := buttons[arg]
+			if !ok {
+				return nil, fmt.Errorf("unknown button %q", arg)
+			}
+			held |= button
+		}
+		return func(t *test) error {
+			t.input.Gamepads[pad-1] = held
+			return nil
+		}, nil
+
+	case "mouse":
+		if len(args) < 2 {
+			return nil, fmt.Errorf("mouse needs a position")
+		}
+		x, err := parseInt(args[0], -32768, 32767)
+		if err != nil {
+			return nil, err
+		}
+		y, err := parseInt(args[1], -32768, 32767)
+		if err != nil {
+			return nil, err
+		}
+		var held byte
+		for _, arg := range args[2:] {
+			button, ok := mouseButtons[arg]
+			if !ok {
+				return nil, fmt.Errorf("unknown mouse button %q", arg)
+			}
+			held |= button
+		}
+		return func(t *test) error {
+			t.input.MouseX = int16(x)
+			t.input.MouseY = int16(y)
+			t.input.MouseButtons = held
+			return nil
+		}, nil
+
+	case "wait":
+		frames := 1
+		if len(args) > 0 {
+			var err error
+			frames, err = parseInt(args[0], 1, 1<<30)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return func(t *test) error {
+			for i := 0; i < frames; i++ {
+				err := t.rt.Step(t.input)
+				if err != nil {
+					return fmt.Errorf("frame %d: %w", t.frame, err)
+				}
+				t.frame++
+			}
+			return nil
+		}, nil
+
+	case "hash":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("hash needs a single hash")
+		}
+		want := strings.ToLower(args[0])
+		if _, err := hex.DecodeString(want); err != nil || len(want) < 8 {
+			return nil, fmt.Errorf("invalid hash %q", args[0])
+		}
+		return func(t *test) error {
+			sum := sha256.Sum256(t.rt.Framebuffer())
+			got := hex.EncodeToString(sum[:])
+			if !strings.HasPrefix(got, want) {
+				t.fail("framebuffer hash is %s, want %s", got, want)
+			}
+			return nil
+		}, nil
+
+	case "pixel":
+		if len(args) != 3 {
+			return nil, fmt.Errorf("pixel needs a position and a color")
+		}
+		x, err := parseInt(args[0], 0, runtime.WIDTH-1)
+		if err != nil {
+			return nil, err
+		}
+		y, err := parseInt(args[1], 0, runtime.HEIGHT-1)
+		if err != nil {
+			return nil, err
+		}
+		want, err := parseInt(args[2], 0, 3)
+		if err != nil {
+			return nil, err
+		}
+		return func(t *test) error {
+			idx := y*runtime.WIDTH + x
+			got := int(t.rt.Framebuffer()[idx/4]>>((idx%4)*2)) & 0x3
+			if got != want {
+				t.fail("pixel (%d,%d) is %d, want %d", x, y, got, want)
+			}
+			return nil
+		}, nil
+
+	case "mem":
+		if len(args) != 3 {
+			return nil, fmt.Errorf("mem needs an address, a size and a value")
+		}
+		addr, err := parseInt(args[0], 0, 0xffff)
+		if err != nil {
+			return nil, err
+		}
+		var size int
+		switch args[1] {
+		case "u8":
+			size = 1
+		case "u16":
+			size = 2
+		case "u32":
+			size = 4
+		default:
+			return nil, fmt.Errorf("unknown size %q", args[1])
+		}
+		want, err := parseUint(args[2], size*8)
+		if err != nil {
+			return nil, err
+		}
+		return func(t *test) error {
+			data, ok := t.rt.Memory().Read(uint32(addr), uint32(size))
+			if !ok {
+				t.fail("%s %#x is out of bounds", args[1], addr)
+				return nil
+			}
+			var got uint64
+			switch size {
+			case 1:
+				got = uint64(data[0])
+			case 2:
+				got = uint64(binary.LittleEndian.Uint16(data))
+			case 4:
+				got = uint64(binary.LittleEndian.Uint32(data))
+			}
+			if got != want {
+				t.fail("%s %#x is %d, want %d", args[1], addr, got, want)
+			}
+			return nil
+		}, nil
+
+	case "trace":
+		want := strings.TrimSpace(strings.TrimPrefix(text, cmd))
+		return func(t *test) error {
+			for i, message := range t.traces {
+				if message == want {
+					t.traces = t.traces[i+1:]
+					return nil
+				}
+			}
+			t.fail("no trace %q among %q", want, t.traces)
+			t.traces = nil
+			return nil
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown command %q", cmd)
+	}
+}
+
+// parseInt parses a number between min and max. Leading zeros don't make it
+// octal, and hexadecimal numbers have no sign.
+func parseInt(s string, min, max int) (int, error) {
+	var v int64
+	var err error
+	if digits, ok := hexDigits(s); ok {
+		var u uint64
+		u, err = strconv.ParseUint(digits, 16, 63)
+		v = int64(u)
+	} else {
+		v, err = strconv.ParseInt(s, 10, 64)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", s)
+	}
+	if v < int64(min) || v > int64(max) {
+		return 0, fmt.Errorf("%d is not between %d and %d", v, min, max)
+	}
+
+	return int(v), nil
+}
+
+// parseUint parses a number that fits into bits.
+func parseUint(s string, bits int) (uint64, error) {
+	digits, base := s, 10
+	if hex, ok := hexDigits(s); ok {
+		digits, base = hex, 16
+	}
+
+	v, err := strconv.ParseUint(digits, base, bits)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q, want a u%d", s, bits)
+	}
+
+	return v, nil
+}
+
+// hexDigits returns the digits of a number with a 0x prefix.
+func hexDigits(s string) (string, bool) {
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		return s[2:], true
+	}
+
+	return "", false
+}
+
+// Run loads the cart with an empty disk and runs the script against it. It
+// returns Failures if any assertion failed, or a different error if the cart
+// couldn't be run at all.
+func (s *Script) Run(code []byte, cart string) error {
+	rt, err := runtime.NewRuntime()
+	if err != nil {
+		return err
+	}
+	defer rt.Close()
+
+	t := &test{name: s.Name, rt: rt}
+	rt.TraceSink = runtime.TraceFunc(func(entry runtime.TraceEntry) {
+		t.traces = append(t.traces, entry.Message)
+	})
+	rt.Storage = runtime.NewMemoryStorage(nil)
+	rt.Budget = s.Budget
+	rt.OnOverrun = runtime.OverrunAbort
+
+	err = rt.LoadCart(code, cart)
+	if err != nil {
+		return err
+	}
+
+	for _, step := range s.steps {
+		t.line = step.line
+		err = step.run(t)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", s.Name, step.line, err)
+		}
+	}
+
+	if len(t.failures) > 0 {
+		return t.failures
+	}
+
+	return nil
+}
+
+func (t *test) fail(format string, args ...any) {
+	message := fmt.Sprintf(format, args...)
+	t.failures = append(t.failures, fmt.Sprintf("%s:%d: %s", t.name, t.line, message))
+}
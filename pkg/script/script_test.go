@@ -0,0 +1,212 @@
+package script
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/christopher-kleine/w4g/pkg/runtime"
+)
+
+func readTinyCart(t *testing.T) []byte {
+	t.Helper()
+
+	code, err := os.ReadFile("testdata/tiny.wasm")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return code
+}
+
+// run parses and runs a script against testdata/tiny.wasm.
+func run(t *testing.T, text string) error {
+	t.Helper()
+
+	s, err := Parse(strings.NewReader(text), "test.w4s")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s.Run(readTinyCart(t), "tiny.wasm")
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   string
+	}{
+		{"unknown command", "jump", "test.w4s:1: unknown command"},
+		{"line after comments", "# comment\n\nwait\nfly 3", "test.w4s:4: unknown command"},
+		{"input without gamepad", "input", "test.w4s:1: input needs a gamepad"},
+		{"gamepad 5", "input 5 x", "test.w4s:1: 5 is not between 1 and 4"},
+		{"unknown button", "wait\ninput 1 a", "test.w4s:2: unknown button"},
+		{"mouse without position", "mouse 10", "test.w4s:1: mouse needs a position"},
+		{"unknown mouse button", "mouse 1 2 thumb", "test.w4s:1: unknown mouse button"},
+		{"wait 0", "wait 0", "test.w4s:1: 0 is not between"},
+		{"wait text", "wait long", "test.w4s:1: "},
+		{"short hash", "hash 5f2c", "test.w4s:1: invalid hash"},
+		{"hash no hex", "hash 5f2c9a0g", "test.w4s:1: invalid hash"},
+		{"pixel outside", "pixel 160 0 1", "test.w4s:1: 160 is not between 0 and 159"},
+		{"pixel color", "pixel 0 0 4", "test.w4s:1: 4 is not between 0 and 3"},
+		{"mem size", "mem 0x19a0 u64 1", "test.w4s:1: unknown size"},
+		{"mem value too large", "mem 0x19a0 u8 256", "test.w4s:1: "},
+		{"mem address", "mem 0x10000 u8 1", "test.w4s:1: "},
+		{"negative hex", "mem 0x-10 u8 1", `test.w4s:1: invalid number "0x-10"`},
+		{"hex without digits", "mem 0x u8 1", `test.w4s:1: invalid number "0x"`},
+		{"binary", "wait 0b11", `test.w4s:1: invalid number "0b11"`},
+		{"octal", "wait 0o7", `test.w4s:1: invalid number "0o7"`},
+		{"underscores", "wait 1_000", `test.w4s:1: invalid number "1_000"`},
+		{"binary value", "mem 0x19a0 u8 0b1", `test.w4s:1: invalid number "0b1", want a u8`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(test.script), "test.w4s")
+			if err == nil || !strings.HasPrefix(err.Error(), test.want) {
+				t.Errorf("got %v, want %s...", err, test.want)
+			}
+		})
+	}
+}
+
+func TestAssertions(t *testing.T) {
+	// After 6 frames the first byte of the framebuffer is 6, the rest is 0
+	framebuffer := make([]byte, runtime.SizeFramebuffer)
+	framebuffer[0] = 6
+	sum := sha256.Sum256(framebuffer)
+	hash := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name   string
+		script string
+		fail   string
+	}{
+		{"hash prefix", "hash " + hash[:8], ""},
+		{"hash upper case", "hash " + strings.ToUpper(hash[:12]), ""},
+		{"full hash", "hash " + hash, ""},
+		{"wrong hash", "hash 00000000", "framebuffer hash is " + hash},
+		{"pixel", "pixel 0 0 2\npixel 1 0 1\npixel 2 0 0", ""},
+		{"wrong pixel", "pixel 0 0 3", "pixel (0,0) is 2, want 3"},
+		{"mem u8", "mem 0x19a0 u8 6", ""},
+		{"wrong mem u8", "mem 0x19a0 u8 7", "u8 0x19a0 is 6, want 7"},
+		{"mem u16", "mem 0x19a4 u16 0xbeef", ""},
+		{"wrong mem u16", "mem 0x19a4 u16 0xbeee", "u16 0x19a4 is 48879, want 48878"},
+		{"mem u32", "mem 0x19a0 u32 6", ""},
+		{"mem upper case hex", "mem 0X19A0 u8 0X06", ""},
+		{"mem decimal address", "mem 6560 u8 6", ""},
+		{"mem leading zero", "mem 0x19a0 u8 006", ""},
+		{"wrong mem u32", "mem 0x19a2 u32 6", "u32 0x19a2 is"},
+		{"mem at the end", "mem 0xfffe u32 0", "u32 0xfffe is out of bounds"},
+		{"input", "input 1 x right\nwait\nmem 0x19a6 u8 0x21", ""},
+		{"released input", "input 1 x\nwait\ninput 1\nwait\nmem 0x19a6 u8 0", ""},
+		{"traces in order", "trace hello\ntrace world\ntrace tick", ""},
+		{"trace with spaces", "trace    hello  ", ""},
+		{"traces out of order", "trace world\ntrace hello", `no trace "hello"`},
+		{"missing trace", "trace goodbye", `no trace "goodbye"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := run(t, "wait 6\n"+test.script)
+
+			if test.fail == "" {
+				if err != nil {
+					t.Errorf("failed with %v", err)
+				}
+				return
+			}
+
+			var failures Failures
+			if !errors.As(err, &failures) {
+				t.Fatalf("got %v, want Failures", err)
+			}
+			if len(failures) != 1 || !strings.Contains(failures[0], test.fail) {
+				t.Errorf("got %q, want a failure with %q", failures, test.fail)
+			}
+		})
+	}
+}
+
+func TestFailures(t *testing.T) {
+	err := run(t, `wait
+pixel 0 0 3
+# Failed assertions don't stop the script
+mem 0x19a0 u32 2
+wait
+mem 0x19a0 u32 2
+trace missing
+hash 00000000`)
+
+	var failures Failures
+	if !errors.As(err, &failures) {
+		t.Fatalf("got %v, want Failures", err)
+	}
+
+	lines := []string{"test.w4s:2: ", "test.w4s:4: ", "test.w4s:7: ", "test.w4s:8: "}
+	if len(failures) != len(lines) {
+		t.Fatalf("got %d failures, want %d:\n%v", len(failures), len(lines), failures)
+	}
+	for i, line := range lines {
+		if !strings.HasPrefix(failures[i], line) {
+			t.Errorf("failure %d is %q, want it on %s", i, failures[i], line)
+		}
+	}
+
+	if got := strings.Count(failures.Error(), "\n"); got != len(lines)-1 {
+		t.Errorf("Error has %d lines", got+1)
+	}
+}
+
+func TestRunError(t *testing.T) {
+	s, err := Parse(strings.NewReader("wait"), "test.w4s")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.Run([]byte("not a cart"), "broken.wasm")
+	var failures Failures
+	if err == nil || errors.As(err, &failures) {
+		t.Errorf("got %v, want the cart to fail loading", err)
+	}
+}
+
+func TestLeadingZeros(t *testing.T) {
+	// 010 is ten frames, not eight
+	err := run(t, "wait 010\nmem 0x19a0 u8 10\npixel 0 0 02")
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRunOverBudget(t *testing.T) {
+	s, err := Parse(strings.NewReader("wait 5\nhash 00000000"), "test.w4s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Budget != DefaultBudget {
+		t.Errorf("budget %v, want %v", s.Budget, DefaultBudget)
+	}
+	s.Budget = 20 * time.Millisecond
+
+	code, err := os.ReadFile("testdata/hang.wasm")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The hanging frame ends the run
+	err = s.Run(code, "hang.wasm")
+	var failures Failures
+	var overrun *runtime.Overrun
+	if !errors.As(err, &overrun) || errors.As(err, &failures) {
+		t.Fatalf("got %v, want an overrun", err)
+	}
+	if !strings.HasPrefix(err.Error(), "test.w4s:1: frame 2: ") {
+		t.Errorf("got %q", err)
+	}
+}
@@ -0,0 +1,9 @@
+;; hang.wasm hangs forever in its third frame. Rebuild it with
+;; wat2wasm hang.wat -o hang.wasm
+(module
+  (import "env" "memory" (memory 1 1))
+  (global $frames (mut i32) (i32.const 0))
+  (func (export "update")
+    (global.set $frames (i32.add (global.get $frames) (i32.const 1)))
+    (if (i32.eq (global.get $frames) (i32.const 3))
+      (then (loop $forever (br $forever))))))
@@ -0,0 +1,20 @@
+;; tiny.wasm traces "hello" and "world" in start. Every frame it counts the
+;; frames at 0x19a0, writes 0xbeef to 0x19a4 and the buttons of gamepad 1 to
+;; 0x19a6, draws the frame count into the first byte of the framebuffer and
+;; traces "tick". Rebuild it with
+;; wat2wasm tiny.wat -o tiny.wasm
+(module
+  (import "env" "memory" (memory 1 1))
+  (import "env" "trace" (func $trace (param i32)))
+  (data (i32.const 0x2000) "hello\00world\00tick\00")
+  (func (export "start")
+    (call $trace (i32.const 0x2000))
+    (call $trace (i32.const 0x2006)))
+  (func (export "update")
+    (local $frame i32)
+    (local.set $frame (i32.add (i32.load (i32.const 0x19a0)) (i32.const 1)))
+    (i32.store (i32.const 0x19a0) (local.get $frame))
+    (i32.store16 (i32.const 0x19a4) (i32.const 0xbeef))
+    (i32.store8 (i32.const 0x19a6) (i32.load8_u (i32.const 0x16)))
+    (i32.store8 (i32.const 0xa0) (local.get $frame))
+    (call $trace (i32.const 0x200c))))
@@ -0,0 +1,385 @@
+// Package wasm implements a shallow parser for WebAssembly binaries. It only
+// decodes the sections w4g needs to inspect or rewrite a cart and keeps
+// everything else as raw bytes.
+package wasm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	SectionCustom    byte = 0
+	SectionType      byte = 1
+	SectionImport    byte = 2
+	SectionFunction  byte = 3
+	SectionTable     byte = 4
+	SectionMemory    byte = 5
+	SectionGlobal    byte = 6
+	SectionExport    byte = 7
+	SectionStart     byte = 8
+	SectionElement   byte = 9
+	SectionCode      byte = 10
+	SectionData      byte = 11
+	SectionDataCount byte = 12
+)
+
+type ValueType byte
+
+const (
+	I32 ValueType = 0x7f
+	I64 ValueType = 0x7e
+	F32 ValueType = 0x7d
+	F64 ValueType = 0x7c
+)
+
+func (t ValueType) String() string {
+	switch t {
+	case I32:
+		return "i32"
+	case I64:
+		return "i64"
+	case F32:
+		return "f32"
+	case F64:
+		return "f64"
+	default:
+		return fmt.Sprintf("0x%02x", byte(t))
+	}
+}
+
+type ExternType byte
+
+const (
+	ExternFunc   ExternType = 0
+	ExternTable  ExternType = 1
+	ExternMemory ExternType = 2
+	ExternGlobal ExternType = 3
+)
+
+func (t ExternType) String() string {
+	switch t {
+	case ExternFunc:
+		return "func"
+	case ExternTable:
+		return "table"
+	case ExternMemory:
+		return "memory"
+	case ExternGlobal:
+		return "global"
+	default:
+		return fmt.Sprintf("0x%02x", byte(t))
+	}
+}
+
+var magic = []byte{0x00, 'a', 's', 'm', 0x01, 0x00, 0x00, 0x00}
+
+var ErrNotWasm = errors.New("not a WebAssembly binary")
+
+type Section struct {
+	ID   byte
+	Data []byte
+}
+
+type FuncType struct {
+	Params  []ValueType
+	Results []ValueType
+}
+
+// Equal reports whether t and other have the same parameters and results.
+func (t FuncType) Equal(other FuncType) bool {
+	return sameValueTypes(t.Params, other.Params) && sameValueTypes(t.Results, other.Results)
+}
+
+// String formats t like (i32, i32) -> i32.
+func (t FuncType) String() string {
+	results := "()"
+	if len(t.Results) == 1 {
+		results = t.Results[0].String()
+	} else if len(t.Results) > 1 {
+		results = formatValueTypes(t.Results)
+	}
+
+	return formatValueTypes(t.Params) + " -> " + results
+}
+
+func formatValueTypes(types []ValueType) string {
+	names := make([]string, len(types))
+	for i, t := range types {
+		names[i] = t.String()
+	}
+
+	return "(" + strings.Join(names, ", ") + ")"
+}
+
+func sameValueTypes(a, b []ValueType) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+type Limits struct {
+	Min    uint32
+	Max    uint32
+	HasMax bool
+}
+
+type GlobalType struct {
+	Type    ValueType
+	Mutable bool
+}
+
+type Import struct {
+	Module string
+	Name   string
+	Type   ExternType
+
+	// Only set for the matching Type.
+	Func   uint32
+	Memory Limits
+	Global GlobalType
+}
+
+type Global struct {
+	GlobalType
+
+	// Init is the raw constant expression, including the final end opcode.
+	Init []byte
+}
+
+type Export struct {
+	Name  string
+	Type  ExternType
+	Index uint32
+}
+
+type Module struct {
+	Sections []Section
+
+	Types     []FuncType
+	Imports   []Import
+	Functions []uint32
+	Memories  []Limits
+	Globals   []Global
+	Exports   []Export
+}
+
+// Parse decodes the sections of a WebAssembly binary.
+func Parse(code []byte) (*Module, error) {
+	if !bytes.HasPrefix(code, magic) {
+		return nil, ErrNotWasm
+	}
+
+	m := &Module{}
+	r := &reader{data: code, pos: len(magic)}
+	for !r.done() {
+		id := r.byte()
+		size := r.u32()
+		data := r.bytes(int(size))
+		if r.err != nil {
+			return nil, fmt.Errorf("section %d: %w", id, r.err)
+		}
+
+		m.Sections = append(m.Sections, Section{ID: id, Data: data})
+
+		err := m.decode(id, data)
+		if err != nil {
+			return nil, fmt.Errorf("section %d: %w", id, err)
+		}
+	}
+
+	return m, nil
+}
+
+func (m *Module) decode(id byte, data []byte) error {
+	r := &reader{data: data}
+
+	switch id {
+	case SectionType:
+		for n := r.u32(); n > 0 && r.err == nil; n-- {
+			if r.byte() != 0x60 {
+				r.fail(errors.New("invalid function type"))
+				break
+			}
+			m.Types = append(m.Types, FuncType{
+				Params:  r.valueTypes(),
+				Results: r.valueTypes(),
+			})
+		}
+
+	case SectionImport:
+		for n := r.u32(); n > 0 && r.err == nil; n-- {
+			imp := Import{
+				Module: r.name(),
+				Name:   r.name(),
+				Type:   ExternType(r.byte()),
+			}
+			switch imp.Type {
+			case ExternFunc:
+				imp.Func = r.u32()
+			case ExternTable:
+				r.byte()
+				r.limits()
+			case ExternMemory:
+				imp.Memory = r.limits()
+			case ExternGlobal:
+				imp.Global = r.globalType()
+			default:
+				return fmt.Errorf("unknown import type %s", imp.Type)
+			}
+			m.Imports = append(m.Imports, imp)
+		}
+
+	case SectionFunction:
+		for n := r.u32(); n > 0 && r.err == nil; n-- {
+			m.Functions = append(m.Functions, r.u32())
+		}
+
+	case SectionMemory:
+		for n := r.u32(); n > 0 && r.err == nil; n-- {
+			m.Memories = append(m.Memories, r.limits())
+		}
+
+	case SectionGlobal:
+		for n := r.u32(); n > 0 && r.err == nil; n-- {
+			m.Globals = append(m.Globals, Global{
+				GlobalType: r.globalType(),
+				Init:       r.constExpr(),
+			})
+		}
+
+	case SectionExport:
+		for n := r.u32(); n > 0 && r.err == nil; n-- {
+			m.Exports = append(m.Exports, Export{
+				Name:  r.name(),
+				Type:  ExternType(r.byte()),
+				Index: r.u32(),
+			})
+		}
+	}
+
+	return r.err
+}
+
+// FuncType returns the type of the function at idx in the index space of
+// functions, which starts with the imported ones.
+func (m *Module) FuncType(idx uint32) (FuncType, bool) {
+	for _, imp := range m.Imports {
+		if imp.Type != ExternFunc {
+			continue
+		}
+		if idx == 0 {
+			return m.typeAt(imp.Func)
+		}
+		idx--
+	}
+
+	if idx >= uint32(len(m.Functions)) {
+		return FuncType{}, false
+	}
+
+	return m.typeAt(m.Functions[idx])
+}
+
+func (m *Module) typeAt(idx uint32) (FuncType, bool) {
+	if idx >= uint32(len(m.Types)) {
+		return FuncType{}, false
+	}
+
+	return m.Types[idx], true
+}
+
+// ImportedGlobals returns the number of imported globals. They come first in
+// the index space of globals, followed by Globals.
+func (m *Module) ImportedGlobals() uint32 {
+	var n uint32
+	for _, imp := range m.Imports {
+		if imp.Type == ExternGlobal {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Encode assembles the module into a binary again. The export section is
+// rebuilt from Exports, all other sections are written as they were parsed.
+func (m *Module) Encode() []byte {
+	exports := m.encodeExports()
+
+	out := append([]byte{}, magic...)
+	written := false
+	for _, section := range m.Sections {
+		data := section.Data
+		switch {
+		case section.ID == SectionExport:
+			data = exports
+			written = true
+
+		case !written && section.ID != SectionCustom && order(section.ID) > order(SectionExport):
+			out = appendSection(out, SectionExport, exports)
+			written = true
+		}
+
+		out = appendSection(out, section.ID, data)
+	}
+
+	if !written {
+		out = appendSection(out, SectionExport, exports)
+	}
+
+	return out
+}
+
+func (m *Module) encodeExports() []byte {
+	data := appendU32(nil, uint32(len(m.Exports)))
+	for _, exp := range m.Exports {
+		data = appendU32(data, uint32(len(exp.Name)))
+		data = append(data, exp.Name...)
+		data = append(data, byte(exp.Type))
+		data = appendU32(data, exp.Index)
+	}
+
+	return data
+}
+
+// order returns the position of a known section in a valid binary. The data
+// count section is the odd one out, as it comes before the code section.
+func order(id byte) int {
+	switch id {
+	case SectionDataCount:
+		return int(SectionCode)
+	case SectionCode, SectionData:
+		return int(id) + 1
+	default:
+		return int(id)
+	}
+}
+
+func appendSection(out []byte, id byte, data []byte) []byte {
+	out = append(out, id)
+	out = appendU32(out, uint32(len(data)))
+
+	return append(out, data...)
+}
+
+func appendU32(out []byte, v uint32) []byte {
+	for {
+		b := byte(v & 0x7f)
+		v >>= 7
+		if v == 0 {
+			return append(out, b)
+		}
+		out = append(out, b|0x80)
+	}
+}
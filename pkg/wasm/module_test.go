@@ -0,0 +1,224 @@
+package wasm
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func readTestdata(t *testing.T, name string) []byte {
+	t.Helper()
+
+	code, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return code
+}
+
+// sectionIDs returns the IDs of the sections of m in order.
+func sectionIDs(m *Module) []byte {
+	var ids []byte
+	for _, section := range m.Sections {
+		ids = append(ids, section.ID)
+	}
+
+	return ids
+}
+
+func TestRoundTrip(t *testing.T) {
+	names, err := filepath.Glob(filepath.Join("testdata", "*.wasm"))
+	if err != nil || len(names) == 0 {
+		t.Fatalf("no carts in testdata: %v", err)
+	}
+
+	for _, name := range names {
+		t.Run(filepath.Base(name), func(t *testing.T) {
+			code := readTestdata(t, filepath.Base(name))
+			m, err := Parse(code)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			encoded := m.Encode()
+
+			// Without an export section, Encode adds an empty one
+			if bytes.Contains(sectionIDs(m), []byte{SectionExport}) {
+				if !bytes.Equal(encoded, code) {
+					t.Errorf("encoded %d bytes differ from the %d parsed", len(encoded), len(code))
+				}
+			}
+
+			again, err := Parse(encoded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(again.Globals, m.Globals) || !reflect.DeepEqual(again.Imports, m.Imports) ||
+				!reflect.DeepEqual(again.Types, m.Types) || len(again.Exports) != len(m.Exports) {
+				t.Errorf("parsed again to a different module")
+			}
+		})
+	}
+}
+
+func TestGlobals(t *testing.T) {
+	m, err := Parse(readTestdata(t, "globals.wasm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := m.ImportedGlobals(); n != 1 {
+		t.Errorf("%d imported globals, want 1", n)
+	}
+
+	want := []GlobalType{
+		{I32, true},
+		{F64, false},
+		{I64, true},
+		{F32, true},
+		{I32, false},
+	}
+	if len(m.Globals) != len(want) {
+		t.Fatalf("%d globals, want %d", len(m.Globals), len(want))
+	}
+	for i, global := range m.Globals {
+		if global.GlobalType != want[i] {
+			t.Errorf("global %d is %+v, want %+v", i, global.GlobalType, want[i])
+		}
+	}
+
+	if v, ok := m.Globals[0].I32(); !ok || v != 0x4000 {
+		t.Errorf("first global starts at %d, %t", v, ok)
+	}
+	if _, ok := m.Globals[4].I32(); ok {
+		t.Error("global initialized with global.get has a constant value")
+	}
+}
+
+func TestEncodeExports(t *testing.T) {
+	tests := []struct {
+		cart string
+		want []byte
+	}{
+		// The export section is replaced where it is
+		{"globals.wasm", []byte{SectionType, SectionImport, SectionFunction, SectionGlobal, SectionExport, SectionCode, SectionCustom}},
+		// or added ahead of the start section. wat2wasm puts a name section
+		// last in both.
+		{"noexports.wasm", []byte{SectionType, SectionImport, SectionFunction, SectionGlobal, SectionExport, SectionStart, SectionCode, SectionData, SectionCustom}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.cart, func(t *testing.T) {
+			m, err := Parse(readTestdata(t, test.cart))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Export the global after the imported ones, as the runtime does
+			exports := append(m.Exports, Export{"__w4g_global_0", ExternGlobal, m.ImportedGlobals()})
+			m.Exports = exports
+
+			again, err := Parse(m.Encode())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(sectionIDs(again), test.want) {
+				t.Errorf("sections %v, want %v", sectionIDs(again), test.want)
+			}
+			if !reflect.DeepEqual(again.Exports, exports) {
+				t.Errorf("exports %+v, want %+v", again.Exports, exports)
+			}
+		})
+	}
+}
+
+func TestEncodeKeepsCustomSections(t *testing.T) {
+	code := readTestdata(t, "noexports.wasm")
+	custom := append([]byte{4}, "note"...)
+	code = append(append(code, SectionCustom, byte(len(custom))), custom...)
+
+	m, err := Parse(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The custom section stays last, after the data
+	ids := sectionIDs(m)
+	again, err := Parse(m.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sectionIDs(again); got[len(got)-1] != SectionCustom || len(got) != len(ids)+1 {
+		t.Errorf("sections %v", got)
+	}
+}
+
+func TestParseTruncated(t *testing.T) {
+	code := readTestdata(t, "globals.wasm")
+	m, err := Parse(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only cuts between sections leave a valid binary
+	boundaries := map[int]bool{len(magic): true}
+	end := len(magic)
+	for _, section := range m.Sections {
+		end += 1 + len(appendU32(nil, uint32(len(section.Data)))) + len(section.Data)
+		boundaries[end] = true
+	}
+
+	for n := 0; n < len(code); n++ {
+		_, err := Parse(code[:n])
+		switch {
+		case n < len(magic):
+			if !errors.Is(err, ErrNotWasm) {
+				t.Errorf("%d bytes: got %v, want ErrNotWasm", n, err)
+			}
+		case boundaries[n]:
+			if err != nil {
+				t.Errorf("%d bytes: %v", n, err)
+			}
+		default:
+			if err == nil {
+				t.Errorf("%d bytes cut in the middle of a section parsed", n)
+			}
+		}
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	module := func(sections ...byte) []byte {
+		return append(append([]byte{}, magic...), sections...)
+	}
+
+	tests := []struct {
+		name string
+		code []byte
+		want string
+	}{
+		{"no magic", []byte("\x00asm\x02\x00\x00\x00"), "not a WebAssembly binary"},
+		{"section too long", module(SectionType, 5, 1, 0x60), "section 1: unexpected end"},
+		{"section size too long", module(SectionType, 0xff, 0xff, 0xff, 0xff, 0xff, 0x0f), "section 1: invalid u32"},
+		{"invalid function type", module(SectionType, 4, 1, 0x61, 0, 0), "section 1: invalid function type"},
+		{"more types than data", module(SectionType, 4, 2, 0x60, 0, 0), "section 1: unexpected end"},
+		{"unknown import kind", module(SectionImport, 6, 1, 1, 'a', 1, 'b', 9), "section 2: unknown import type 0x09"},
+		{"name past the section", module(SectionExport, 3, 1, 9, 'a'), "section 7: unexpected end"},
+		{"global without end", module(SectionGlobal, 4, 1, byte(I32), 0, 0x41), "section 6: unexpected end"},
+		{"global with a call", module(SectionGlobal, 5, 1, byte(I32), 0, 0x10, 0), "section 6: unsupported opcode 0x10"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Parse(test.code)
+			if err == nil || !strings.HasPrefix(err.Error(), test.want) {
+				t.Errorf("got %v, want %s", err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package wasm
+
+// Subsections of the name section.
+const (
+	nameFunctions = 1
+	nameGlobals   = 7
+)
+
+// FunctionNames returns the names of the functions by their index, imports
+// included. Names come from the name section, which compilers only emit
+// with debug info. Functions without a name there fall back to the name
+// they are exported with.
+func (m *Module) FunctionNames() map[uint32]string {
+	names := map[uint32]string{}
+
+	for _, exp := range m.Exports {
+		if exp.Type == ExternFunc {
+			names[exp.Index] = exp.Name
+		}
+	}
+
+	m.readNames(nameFunctions, names)
+
+	return names
+}
+
+// GlobalNames returns the names of the globals by their index, imports
+// included, like FunctionNames does for functions.
+func (m *Module) GlobalNames() map[uint32]string {
+	names := map[uint32]string{}
+
+	for _, exp := range m.Exports {
+		if exp.Type == ExternGlobal {
+			names[exp.Index] = exp.Name
+		}
+	}
+
+	m.readNames(nameGlobals, names)
+
+	return names
+}
+
+// readNames adds the name map of a subsection of the name section to names.
+func (m *Module) readNames(subsection byte, names map[uint32]string) {
+	for _, section := range m.Sections {
+		if section.ID != SectionCustom {
+			continue
+		}
+
+		r := &reader{data: section.Data}
+		if r.name() != "name" {
+			continue
+		}
+
+		for !r.done() {
+			id := r.byte()
+			data := r.bytes(int(r.u32()))
+			if id != subsection {
+				continue
+			}
+
+			sub := &reader{data: data}
+			for n := sub.u32(); n > 0 && sub.err == nil; n-- {
+				idx := sub.u32()
+				name := sub.name()
+				if sub.err == nil {
+					names[idx] = name
+				}
+			}
+		}
+	}
+}
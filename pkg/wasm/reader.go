@@ -0,0 +1,174 @@
+package wasm
+
+import (
+	"errors"
+	"fmt"
+)
+
+var errEOF = errors.New("unexpected end of data")
+
+// reader decodes the primitive values of the binary format. The first error
+// sticks, all further reads return zero values.
+type reader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *reader) done() bool {
+	return r.err != nil || r.pos >= len(r.data)
+}
+
+func (r *reader) fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+func (r *reader) byte() byte {
+	if r.err != nil {
+		return 0
+	}
+	if r.pos >= len(r.data) {
+		r.fail(errEOF)
+		return 0
+	}
+
+	b := r.data[r.pos]
+	r.pos++
+
+	return b
+}
+
+func (r *reader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || r.pos+n > len(r.data) {
+		r.fail(errEOF)
+		return nil
+	}
+
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+
+	return b
+}
+
+func (r *reader) u32() uint32 {
+	var result uint32
+	for shift := 0; shift < 35; shift += 7 {
+		b := r.byte()
+		result |= uint32(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return result
+		}
+	}
+
+	r.fail(errors.New("invalid u32"))
+
+	return 0
+}
+
+func (r *reader) s64(bits int) int64 {
+	var (
+		result int64
+		shift  int
+		b      byte = 0x80
+	)
+
+	for b&0x80 != 0 {
+		if shift >= (bits+6)/7*7 {
+			r.fail(fmt.Errorf("invalid s%d", bits))
+			return 0
+		}
+
+		b = r.byte()
+		result |= int64(b&0x7f) << shift
+		shift += 7
+	}
+
+	if shift < 64 && b&0x40 != 0 {
+		result |= -1 << shift
+	}
+
+	return result
+}
+
+func (r *reader) name() string {
+	return string(r.bytes(int(r.u32())))
+}
+
+func (r *reader) valueTypes() []ValueType {
+	n := r.u32()
+
+	var types []ValueType
+	for i := uint32(0); i < n && r.err == nil; i++ {
+		types = append(types, ValueType(r.byte()))
+	}
+
+	return types
+}
+
+func (r *reader) limits() Limits {
+	var l Limits
+
+	flags := r.byte()
+	l.Min = r.u32()
+	if flags&1 == 1 {
+		l.HasMax = true
+		l.Max = r.u32()
+	}
+
+	return l
+}
+
+func (r *reader) globalType() GlobalType {
+	return GlobalType{
+		Type:    ValueType(r.byte()),
+		Mutable: r.byte() == 1,
+	}
+}
+
+// constExpr returns the raw bytes of a constant expression up to and
+// including its end opcode.
+func (r *reader) constExpr() []byte {
+	start := r.pos
+	for r.err == nil {
+		switch op := r.byte(); op {
+		case 0x0b: // end
+			return r.data[start:r.pos]
+		case 0x41: // i32.const
+			r.s64(32)
+		case 0x42: // i64.const
+			r.s64(64)
+		case 0x43: // f32.const
+			r.bytes(4)
+		case 0x44: // f64.const
+			r.bytes(8)
+		case 0x23, 0xd2: // global.get, ref.func
+			r.u32()
+		case 0xd0: // ref.null
+			r.byte()
+		default:
+			r.fail(fmt.Errorf("unsupported opcode 0x%02x in constant expression", op))
+		}
+	}
+
+	return nil
+}
+
+// I32 returns the initial value of the global if it is a plain i32.const.
+func (g Global) I32() (int32, bool) {
+	if g.Type != I32 || len(g.Init) == 0 || g.Init[0] != 0x41 {
+		return 0, false
+	}
+
+	r := &reader{data: g.Init, pos: 1}
+	v := r.s64(32)
+	if r.err != nil {
+		return 0, false
+	}
+
+	return int32(v), true
+}
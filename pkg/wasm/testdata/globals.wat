@@ -0,0 +1,15 @@
+;; globals.wasm imports a global ahead of its own mutable and immutable
+;; globals of every type. Rebuild it with
+;; wat2wasm globals.wat -o globals.wasm
+(module
+  (import "env" "memory" (memory 1 1))
+  (import "env" "seed" (global $seed i32))
+  (import "env" "trace" (func $trace (param i32)))
+  (global $sp (mut i32) (i32.const 0x4000))
+  (global $pi f64 (f64.const 3.14159))
+  (global $ticks (mut i64) (i64.const -1))
+  (global $speed (mut f32) (f32.const 0.5))
+  (global $copy i32 (global.get $seed))
+  (func (export "update")
+    (global.set $sp (i32.add (global.get $sp) (global.get $copy)))
+    (global.set $ticks (i64.add (global.get $ticks) (i64.const 1)))))
@@ -0,0 +1,10 @@
+;; noexports.wasm has no export section, but a start function, code and
+;; data after where it would be. Rebuild it with
+;; wat2wasm noexports.wat -o noexports.wasm
+(module
+  (import "env" "memory" (memory 1 1))
+  (global $frames (mut i32) (i32.const 0))
+  (func $start
+    (global.set $frames (i32.const 1)))
+  (start $start)
+  (data (i32.const 0x19a0) "w4g"))
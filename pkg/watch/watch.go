@@ -0,0 +1,150 @@
+// Package watch notices changes to files by polling them. Polling needs no
+// platform support and carts and their sources are small enough to be
+// checked a few times a second.
+package watch
+
+import (
+	"context"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// DefaultInterval is the time between two polls of a new Watcher.
+const DefaultInterval = 250 * time.Millisecond
+
+// Watcher keeps track of files and directory trees.
+type Watcher struct {
+	Interval time.Duration
+
+	// Ignore skips files and directories, like build output. If it is nil,
+	// hidden files and directories are ignored.
+	Ignore func(path string, info fs.FileInfo) bool
+
+	paths []string
+	known map[string]stamp
+}
+
+// stamp is what tells a file changed.
+type stamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// New watches the given files and directories. Paths that don't exist yet
+// are picked up once they are created.
+func New(paths ...string) *Watcher {
+	return &Watcher{
+		Interval: DefaultInterval,
+		paths:    paths,
+	}
+}
+
+// Poll checks the paths once and returns the files that were created,
+// changed or removed since the last Poll, sorted by name. The first Poll
+// only takes note of the files.
+func (w *Watcher) Poll() []string {
+	files := map[string]stamp{}
+	for _, path := range w.paths {
+		w.scan(path, files)
+	}
+
+	var changed []string
+	if w.known != nil {
+		for name, s := range files {
+			if old, ok := w.known[name]; !ok || old != s {
+				changed = append(changed, name)
+			}
+		}
+		for name := range w.known {
+			if _, ok := files[name]; !ok {
+				changed = append(changed, name)
+			}
+		}
+	}
+	w.known = files
+
+	sort.Strings(changed)
+
+	return changed
+}
+
+func (w *Watcher) scan(root string, files map[string]stamp) {
+	filepath.Walk(root, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+
+		if path != root && w.ignore(path, info) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !info.IsDir() {
+			files[path] = stamp{size: info.Size(), modTime: info.ModTime()}
+		}
+
+		return nil
+	})
+}
+
+func (w *Watcher) ignore(path string, info fs.FileInfo) bool {
+	if w.Ignore != nil {
+		return w.Ignore(path, info)
+	}
+
+	name := info.Name()
+
+	return len(name) > 1 && name[0] == '.'
+}
+
+// Watch polls until ctx is done and sends the changed files on the returned
+// channel. Changes are only sent once the files stopped changing for an
+// Interval, so a file is never reported while it is still being written.
+func (w *Watcher) Watch(ctx context.Context) <-chan []string {
+	ch := make(chan []string)
+
+	w.Poll()
+
+	go func() {
+		defer close(ch)
+
+		ticker := time.NewTicker(w.Interval)
+		defer ticker.Stop()
+
+		pending := map[string]bool{}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			changed := w.Poll()
+			for _, name := range changed {
+				pending[name] = true
+			}
+			if len(changed) > 0 || len(pending) == 0 {
+				continue
+			}
+
+			names := make([]string, 0, len(pending))
+			for name := range pending {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			select {
+			case ch <- names:
+				pending = map[string]bool{}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch
+}
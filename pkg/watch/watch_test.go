@@ -0,0 +1,52 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPoll(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		t.Helper()
+
+		err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("main.c", "int main;")
+	write(".hidden", "")
+
+	w := New(dir)
+	if changed := w.Poll(); changed != nil {
+		t.Errorf("first poll: got %v, want nothing", changed)
+	}
+
+	write("main.c", "int main();")
+	write("util.c", "")
+	write(".hidden", "changed")
+	err := os.Chtimes(filepath.Join(dir, "main.c"), time.Now(), time.Now().Add(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{filepath.Join(dir, "main.c"), filepath.Join(dir, "util.c")}
+	if changed := w.Poll(); !reflect.DeepEqual(changed, want) {
+		t.Errorf("got %v, want %v", changed, want)
+	}
+
+	err = os.Remove(filepath.Join(dir, "util.c"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want = []string{filepath.Join(dir, "util.c")}
+	if changed := w.Poll(); !reflect.DeepEqual(changed, want) {
+		t.Errorf("got %v, want %v", changed, want)
+	}
+}